@@ -0,0 +1,118 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// auditConcurrency is the number of simultaneous downloads made by Audit.
+const auditConcurrency = 4
+
+// AuditReport summarizes the result of a bucket audit.
+type AuditReport struct {
+	// Listed is the number of objects seen in the bucket.
+	Listed int
+
+	// Checked is the number of objects that were downloaded.
+	Checked int
+
+	// Mismatched holds the names of objects whose contents do not match the
+	// SHA1 recorded by B2.
+	Mismatched []string
+
+	// Unverified holds the names of objects that were downloaded but had no
+	// SHA1 to compare against, such as large files uploaded without one.
+	Unverified []string
+
+	// Errors maps object names to the error encountered downloading them.
+	Errors map[string]error
+}
+
+// Audit downloads a random sample of the bucket's current objects and checks
+// each one against the SHA1 hash that was recorded when it was uploaded.
+// samplePercent is the percentage of objects, from 0 to 100, to check.
+//
+// Audit stops downloading new objects when ctx is cancelled, and returns the
+// partial report along with the context's error.
+func (b *Bucket) Audit(ctx context.Context, samplePercent float64) (*AuditReport, error) {
+	rep := &AuditReport{
+		Errors: make(map[string]error),
+	}
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	ch := make(chan *Object)
+	for i := 0; i < auditConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range ch {
+				err, ok := auditObject(ctx, o)
+				mu.Lock()
+				rep.Checked++
+				switch {
+				case err != nil && ok:
+					rep.Mismatched = append(rep.Mismatched, o.Name())
+				case err != nil:
+					rep.Errors[o.Name()] = err
+				case !ok:
+					rep.Unverified = append(rep.Unverified, o.Name())
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	iter := b.List(ctx)
+	var err error
+	for iter.Next() {
+		rep.Listed++
+		if rand.Float64()*100 >= samplePercent {
+			continue
+		}
+		select {
+		case ch <- iter.Object():
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if err == nil {
+		err = iter.Err()
+	}
+	sort.Strings(rep.Mismatched)
+	sort.Strings(rep.Unverified)
+	return rep, err
+}
+
+// auditObject reads the entire object and verifies it.  It has the same
+// return semantics as Reader.Verify, except that other errors are returned
+// with false.
+func auditObject(ctx context.Context, o *Object) (error, bool) {
+	r := o.NewReader(ctx)
+	defer r.Close()
+	if _, err := io.Copy(discard{}, r); err != nil {
+		return err, false
+	}
+	return r.Verify()
+}
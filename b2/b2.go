@@ -35,6 +35,7 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -47,6 +48,8 @@ type Client struct {
 	sWriters map[string]*Writer
 	sReaders map[string]*Reader
 	sMethods []methodCounter
+	txStats  TransactionStats
+	mem      int64
 	opts     clientOptions
 }
 
@@ -77,20 +80,28 @@ func NewClient(ctx context.Context, account, key string, opts ...ClientOption) (
 type clientOptions struct {
 	client          *Client
 	transport       http.RoundTripper
+	httpClient      *http.Client
+	retryPolicy     RetryPolicy
+	jitter          *jitterSource
 	failSomeUploads bool
 	expireTokens    bool
 	capExceeded     bool
 	apiBase         string
+	altAPIBases     []string
 	userAgents      []string
 	writerOpts      []WriterOption
+	dedup           DedupIndex
+	tracer          Tracer
+	logger          Logger
 }
 
 // A ClientOption allows callers to adjust various per-client settings.
 type ClientOption func(*clientOptions)
 
-// UserAgent sets the User-Agent HTTP header.  The default header is
-// "blazer/<version>"; the value set here will be prepended to that.  This can
-// be set multiple times.
+// UserAgent sets the User-Agent HTTP header sent with every request, including
+// uploads and downloads.  The default header is "blazer/<version>"; the value
+// set here will be prepended to that.  This can be set multiple times, with
+// the last value set coming first.
 //
 // A user agent is generally of the form "<product>/<version> (<comments>)".
 func UserAgent(agent string) ClientOption {
@@ -100,20 +111,49 @@ func UserAgent(agent string) ClientOption {
 }
 
 // APIBase returns a ClientOption specifying the URL root of API requests.
+// Only b2_authorize_account is sent there; every later request, including
+// uploads and downloads, goes to the API, download, and upload hosts that
+// the authorization reply names.  Pointing APIBase at a mock server that
+// names itself in its reply therefore keeps all of the client's traffic
+// local.
 func APIBase(url string) ClientOption {
 	return func(o *clientOptions) {
 		o.apiBase = url
 	}
 }
 
-// Transport sets the underlying HTTP transport mechanism.  If unset,
-// http.DefaultTransport is used.
+// AlternateAPIBases returns a ClientOption giving further URL roots against
+// which to authorize, in order, if the primary one (the default, or the one
+// set by APIBase) cannot be reached.  The client moves on to the next URL when
+// authorization fails without an HTTP response, or with a 5xx status; any
+// other error is returned at once.  This applies every time the client
+// authorizes, including when its token is refreshed.
+func AlternateAPIBases(urls ...string) ClientOption {
+	return func(o *clientOptions) {
+		o.altAPIBases = append(o.altAPIBases, urls...)
+	}
+}
+
+// Transport sets the underlying HTTP transport mechanism.  If unset, a copy
+// of http.DefaultTransport is used that keeps more idle connections to each
+// host, since concurrent uploads and downloads each hold one.
 func Transport(rt http.RoundTripper) ClientOption {
 	return func(c *clientOptions) {
 		c.transport = rt
 	}
 }
 
+// WithHTTPClient returns a ClientOption that sends every request the client
+// makes, including authorization, uploads, and downloads, through hc, so that
+// its transport, timeout, redirect policy, and cookie jar all apply.  Uploads
+// and downloads go to other hosts than the API's, which hc must be able to
+// reach.  WithHTTPClient takes precedence over Transport.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *clientOptions) {
+		c.httpClient = hc
+	}
+}
+
 // FailSomeUploads requests intermittent upload failures from the B2 service.
 // This is mostly useful for testing.
 func FailSomeUploads() ClientOption {
@@ -153,7 +193,7 @@ func (ct *clientTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	m := r.Header.Get("X-Blazer-Method")
 	t := ct.rt
 	if t == nil {
-		t = http.DefaultTransport
+		t = standardTransport()
 	}
 	b := time.Now()
 	resp, err := t.RoundTrip(r)
@@ -171,13 +211,57 @@ func (ct *clientTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		for _, counter := range ct.client.sMethods {
 			counter.record(m)
 		}
+		ct.client.txStats.record(m.name)
 		ct.client.slock.Unlock()
 	}
 	return resp, nil
 }
 
+var (
+	dtOnce sync.Once
+	dt     http.RoundTripper
+)
+
+// standardTransport returns the transport used when none is given.
+func standardTransport() http.RoundTripper {
+	dtOnce.Do(func() {
+		t, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			// The program has replaced it; use theirs.
+			dt = http.DefaultTransport
+			return
+		}
+		t = t.Clone()
+		t.MaxIdleConnsPerHost = 32
+		dt = t
+	})
+	return dt
+}
+
+// httpClientTransport sends requests through an http.Client.
+type httpClientTransport struct {
+	c *http.Client
+}
+
+func (t httpClientTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.c.Do(r)
+	if uerr, ok := err.(*url.Error); ok {
+		// Context and certificate errors are handled specially, so they must
+		// not be wrapped.
+		return resp, uerr.Err
+	}
+	return resp, err
+}
+
 // Bucket is a reference to a B2 bucket.
 type Bucket struct {
+	// ContentTypeByExt maps file extensions, including the leading dot, to
+	// the content type that writers should use for objects whose names end in
+	// them.  It is consulted only when no content type is set explicitly, and
+	// takes precedence over mime.TypeByExtension.  Unknown extensions are
+	// uploaded as "application/octet-stream".
+	ContentTypeByExt map[string]string
+
 	b beBucketInterface
 	r beRootInterface
 
@@ -209,6 +293,20 @@ type BucketAttrs struct {
 	// the rules are not modified.  A bucket's rules can be removed by updating
 	// with an empty slice.
 	LifecycleRules []LifecycleRule
+
+	// Replication reports or sets the bucket's cloud replication
+	// configuration.  If nil during a bucket.Update, the configuration is not
+	// modified.  Replication can be removed by updating with an empty
+	// ReplicationConfiguration.
+	Replication *ReplicationConfiguration
+
+	// CORSRules reports the bucket's cross-origin resource sharing rules.  It
+	// is ignored by bucket.Update.
+	CORSRules []CORSRule
+
+	// ObjectLock reports the bucket's object lock configuration, if B2
+	// returned one.  It is ignored by bucket.Update.
+	ObjectLock *ObjectLockConfiguration
 }
 
 // A LifecycleRule describes an object's life cycle, namely how many days after
@@ -230,10 +328,54 @@ type LifecycleRule struct {
 	DaysHiddenUntilDeleted int
 }
 
+// A CORSRule allows browsers on other origins to make requests of a bucket.
+type CORSRule struct {
+	// Name identifies the rule.
+	Name string
+
+	// AllowedOrigins lists the origins, such as "https://example.com", that
+	// may make requests.  "*" allows every origin.
+	AllowedOrigins []string
+
+	// AllowedOperations lists the B2 or S3 operations, such as
+	// "b2_download_file_by_name", that the rule allows.
+	AllowedOperations []string
+
+	// AllowedHeaders lists the headers allowed in a preflight request.
+	AllowedHeaders []string
+
+	// ExposeHeaders lists the response headers a browser may expose.
+	ExposeHeaders []string
+
+	// MaxAge is how long a browser may cache the preflight response.
+	MaxAge time.Duration
+}
+
+// ObjectLockConfiguration describes a bucket's object lock settings.
+type ObjectLockConfiguration struct {
+	// Readable is false if the client's key may not read the bucket's object
+	// lock settings.  In that case, the other fields are unset.
+	Readable bool
+
+	// Enabled reports whether object lock is enabled for the bucket.
+	Enabled bool
+
+	// DefaultMode is the default retention mode, "governance" or
+	// "compliance", or empty if there is no default retention.
+	DefaultMode string
+
+	// DefaultPeriod is the length of the default retention period, in units of
+	// DefaultUnit, which is "days" or "years".
+	DefaultPeriod int
+	DefaultUnit   string
+}
+
 type b2err struct {
 	err              error
 	notFoundErr      bool
 	isUpdateConflict bool
+	manifestErr      bool
+	alreadyHidden    bool
 }
 
 func (e b2err) Error() string {
@@ -250,6 +392,16 @@ func IsNotExist(err error) bool {
 	return berr.notFoundErr
 }
 
+// IsAlreadyHidden reports whether a given error is the result of hiding an
+// object that is already hidden.
+func IsAlreadyHidden(err error) bool {
+	berr, ok := err.(b2err)
+	if !ok {
+		return false
+	}
+	return berr.alreadyHidden
+}
+
 const uploadURLPoolSize = 100
 
 type urlPool struct {
@@ -280,8 +432,15 @@ func (p *urlPool) put(u beURLInterface) {
 	}
 }
 
-// Bucket returns a bucket if it exists.
+// Bucket returns a bucket if it exists.  If the client's application key is
+// restricted to a different bucket, the returned error says so.
 func (c *Client) Bucket(ctx context.Context, name string) (*Bucket, error) {
+	if err := c.checkAllowed(name); err != nil {
+		return nil, err
+	}
+	if b := c.restrictedBucket(name); b != nil {
+		return b, nil
+	}
 	buckets, err := c.backend.listBuckets(ctx, name)
 	if err != nil {
 		return nil, err
@@ -306,6 +465,12 @@ func (c *Client) Bucket(ctx context.Context, name string) (*Bucket, error) {
 // if it does not already exist.  If attrs is nil, it is created as a private
 // bucket with no info metadata and no lifecycle rules.
 func (c *Client) NewBucket(ctx context.Context, name string, attrs *BucketAttrs) (*Bucket, error) {
+	if err := c.checkAllowed(name); err != nil {
+		return nil, err
+	}
+	if b := c.restrictedBucket(name); b != nil {
+		return b, nil
+	}
 	buckets, err := c.backend.listBuckets(ctx, name)
 	if err != nil {
 		return nil, err
@@ -335,7 +500,166 @@ func (c *Client) NewBucket(ctx context.Context, name string, attrs *BucketAttrs)
 	}, err
 }
 
-// ListBuckets returns all the available buckets.
+// NewReaderFromURL returns a reader for the object at the given download URL,
+// which must be of the form https://<host>/file/<bucket>/<name>, as returned
+// by Object.URL.  If the bucket belongs to the client's account, the object is
+// downloaded with the client's authorization, as by Object.NewReader.
+// Otherwise the file is downloaded from the URL's host without authorization,
+// which succeeds only if the bucket is public.
+func (c *Client) NewReaderFromURL(ctx context.Context, rawurl string) (*Reader, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.EscapedPath(), "/"), "/", 3)
+	if u.Host == "" || len(parts) != 3 || parts[0] != "file" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("%s: not a B2 download URL", rawurl)
+	}
+	bucketName, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	name, err := url.QueryUnescape(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if allowed, ok := c.AllowedBucket(); !ok || allowed == bucketName {
+		bucket, err := c.Bucket(ctx, bucketName)
+		if err == nil {
+			return bucket.Object(name).NewReader(ctx), nil
+		}
+		if !IsNotExist(err) {
+			return nil, err
+		}
+	}
+	bucket := &Bucket{
+		b:       c.backend.publicBucket(bucketName, u.Scheme+"://"+u.Host),
+		r:       c.backend,
+		c:       c,
+		urlPool: newURLPool(),
+	}
+	return bucket.Object(name).NewReader(ctx), nil
+}
+
+// AllowedBucket returns the name of the bucket to which the client's
+// application key is restricted.  If restricted is false, the key may access
+// any bucket in the account.  If restricted is true but name is empty, the
+// key's bucket has been deleted.
+func (c *Client) AllowedBucket() (name string, restricted bool) {
+	id, name := c.backend.allowedBucket()
+	return name, id != ""
+}
+
+// Allowance describes what a client's application key may do, as reported by
+// b2_authorize_account.
+type Allowance struct {
+	// Capabilities lists the operations the key may perform, such as
+	// "listFiles" or "writeFiles".
+	Capabilities []string
+
+	// BucketID and BucketName identify the bucket to which the key is
+	// restricted.  Both are empty if the key may access any bucket in the
+	// account, and BucketName is empty if the key's bucket has been deleted.
+	BucketID   string
+	BucketName string
+
+	// NamePrefix, if set, restricts the key to objects whose names begin with
+	// it.
+	NamePrefix string
+}
+
+// HasCapability reports whether the key may perform the named operation.
+func (a Allowance) HasCapability(capability string) bool {
+	for _, c := range a.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns what the client's application key may do, as of the
+// client's most recent authorization.  It can be used to check a
+// least-privilege key before relying on it.
+func (c *Client) Allowed() Allowance {
+	id, name := c.backend.allowedBucket()
+	caps, prefix := c.backend.allowance()
+	return Allowance{
+		Capabilities: append([]string(nil), caps...),
+		BucketID:     id,
+		BucketName:   name,
+		NamePrefix:   prefix,
+	}
+}
+
+// restrictedBucket returns the named bucket without looking it up, if the
+// client's key is restricted to it and lacks the listBuckets capability.  B2
+// would refuse the lookup, and the authorization already names the bucket.
+// The bucket's cached attributes are empty.
+func (c *Client) restrictedBucket(name string) *Bucket {
+	a := c.Allowed()
+	if a.BucketID == "" || a.BucketName != name || a.HasCapability("listBuckets") {
+		return nil
+	}
+	return &Bucket{
+		b:       c.backend.bucket(a.BucketID, name),
+		r:       c.backend,
+		c:       c,
+		urlPool: newURLPool(),
+	}
+}
+
+// S3APIURL returns the endpoint of the account's S3-compatible API, for use
+// with S3 tooling.  It is empty if B2 did not report one.
+func (c *Client) S3APIURL() string {
+	return c.backend.s3APIURL()
+}
+
+// RawAuthInfo returns a copy of the decoded JSON reply to the client's most
+// recent b2_authorize_account call, giving access to fields that this package
+// does not otherwise expose.  The reply includes the account's authorization
+// token, and should be handled accordingly.
+func (c *Client) RawAuthInfo() map[string]interface{} {
+	raw := c.backend.rawAuthInfo()
+	if raw == nil {
+		return nil
+	}
+	return copyJSON(raw).(map[string]interface{})
+}
+
+// copyJSON deep-copies a value decoded by encoding/json.
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyJSON(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = copyJSON(e)
+		}
+		return s
+	}
+	return v
+}
+
+func (c *Client) checkAllowed(name string) error {
+	allowed, ok := c.AllowedBucket()
+	if !ok || allowed == name {
+		return nil
+	}
+	return b2err{
+		err: fmt.Errorf("%s: application key is restricted to bucket %q", name, allowed),
+	}
+}
+
+// ListBuckets returns all the available buckets.  Every setting B2 reports for
+// the buckets, including their lifecycle rules, CORS rules, replication, and
+// object lock configuration, is available from each bucket's CachedAttrs
+// method without further requests.
 func (c *Client) ListBuckets(ctx context.Context) ([]*Bucket, error) {
 	bs, err := c.backend.listBuckets(ctx, "")
 	if err != nil {
@@ -353,6 +677,31 @@ func (c *Client) ListBuckets(ctx context.Context) ([]*Bucket, error) {
 	return buckets, nil
 }
 
+// pingBucket is the bucket name used to filter Ping's listing, for keys that
+// may list every bucket.  It need not exist; the filter only keeps the
+// response small.
+const pingBucket = "blazer-ping"
+
+// Ping verifies that B2 is reachable and that the client's credentials are
+// valid, reauthorizing if necessary, and is cheap enough to use for health
+// checks.  If the key may list buckets, Ping makes a single, small
+// b2_list_buckets call, naming the key's bucket if it is restricted to one.
+// Otherwise it authorizes the account again, which B2 limits more strictly, so
+// such keys should be pinged less often.
+func (c *Client) Ping(ctx context.Context) error {
+	a := c.Allowed()
+	if !a.HasCapability("listBuckets") {
+		return c.backend.reauthorizeAccount(ctx)
+	}
+	name := pingBucket
+	if a.BucketID != "" {
+		// B2 refuses to list other buckets with a restricted key.
+		name = a.BucketName
+	}
+	_, err := c.backend.listBuckets(ctx, name)
+	return err
+}
+
 // IsUpdateConflict reports whether a given error is the result of a bucket
 // update conflict.
 func IsUpdateConflict(err error) bool {
@@ -367,6 +716,11 @@ func IsUpdateConflict(err error) bool {
 // this method could fail with an update conflict, in which case you should
 // retrieve the latest bucket attributes with Attrs and try again.
 func (b *Bucket) Update(ctx context.Context, attrs *BucketAttrs) error {
+	if attrs != nil && attrs.Replication != nil {
+		if err := attrs.Replication.validate(); err != nil {
+			return err
+		}
+	}
 	return b.b.updateBucket(ctx, attrs)
 }
 
@@ -380,6 +734,81 @@ func (b *Bucket) Attrs(ctx context.Context) (*BucketAttrs, error) {
 	return b.b.attrs(), nil
 }
 
+// UnfinishedLargeFiles returns every large file with exactly the given name
+// that has been started but neither finished nor cancelled, in the order B2
+// lists them.
+func (b *Bucket) UnfinishedLargeFiles(ctx context.Context, name string) ([]*Object, error) {
+	var objs []*Object
+	iter := b.List(ctx, ListPrefix(name), ListUnfinished())
+	for iter.Next() {
+		if obj := iter.Object(); obj.Name() == name {
+			objs = append(objs, obj)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// ListUnfinishedLargeFiles returns up to count large files that have been
+// started but neither finished nor cancelled, beginning at cursor, which is ""
+// for the first page.  It also returns the cursor for the next page, which is
+// "" when there are no more.  Unlike List, it makes exactly one request, so
+// callers can page through the files themselves.  The objects' IDs, names,
+// content types, and upload times are all available without another request.
+func (b *Bucket) ListUnfinishedLargeFiles(ctx context.Context, count int, cursor string) ([]*Object, string, error) {
+	fs, next, err := b.b.listUnfinishedLargeFiles(ctx, count, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var objs []*Object
+	for _, f := range fs {
+		objs = append(objs, &Object{
+			name: f.name(),
+			f:    f,
+			b:    b,
+		})
+	}
+	return objs, next, nil
+}
+
+// CleanupUnfinished cancels every unfinished large file in the bucket that
+// was started more than olderThan ago, such as those left by a process that
+// crashed mid-upload, and returns the number cancelled.  It stops at the first
+// error.  An olderThan long enough to outlast any upload in progress should be
+// chosen, as those are cancelled too.
+func (b *Bucket) CleanupUnfinished(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var n int
+	iter := b.List(ctx, ListUnfinished())
+	for iter.Next() {
+		obj := iter.Object()
+		if !obj.f.timestamp().Before(cutoff) {
+			continue
+		}
+		if err := b.CancelLargeFile(ctx, obj.ID()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Err()
+}
+
+// CancelLargeFile cancels the unfinished large file with the given ID, such as
+// one found with ListUnfinished or UnfinishedLargeFiles, deleting the parts
+// uploaded so far.
+func (b *Bucket) CancelLargeFile(ctx context.Context, fileID string) error {
+	return b.b.file(fileID, "").compileParts(0, nil).cancel(ctx)
+}
+
+// CachedAttrs returns the bucket's attributes as of when it was last
+// retrieved, from Client.Bucket, Client.ListBuckets, or Bucket.Attrs.  Unlike
+// Attrs, it does not make a request to B2.
+func (b *Bucket) CachedAttrs() *BucketAttrs {
+	return b.b.attrs()
+}
+
 var bNotExist = regexp.MustCompile("Bucket.*does not exist")
 
 // Delete removes a bucket.  The bucket must be empty.
@@ -415,22 +844,37 @@ func (b *Bucket) Name() string {
 
 // Object represents a B2 object.
 type Object struct {
-	attrs *Attrs
 	name  string
 	f     beFileInterface
 	b     *Bucket
+	parts *UploadedParts // from ListUploadedParts
+
+	amu    sync.Mutex
+	attrs  *Attrs          // cached by Attrs
+	attrsF beFileInterface // the version attrs describes
 }
 
 // Attrs holds an object's metadata.
 type Attrs struct {
 	Name            string            // Not used on upload.
 	Size            int64             // Not used on upload.
-	ContentType     string            // Used on upload, default is "application/octet-stream".
+	ContentType     string            // Used on upload, default is derived from the name's extension, or "application/octet-stream".
 	Status          ObjectState       // Not used on upload.
 	UploadTimestamp time.Time         // Not used on upload.
 	SHA1            string            // Can be "none" for large files.  If set on upload, will be used for large files.
 	LastModified    time.Time         // If present, and there are fewer than 10 keys in the Info field, this is saved on upload.
 	Info            map[string]string // Save arbitrary metadata on upload, but limited to 10 keys.
+
+	// LastModifiedKey is the Info key under which LastModified is saved on
+	// upload.  The default is "src_last_modified_millis", which is the
+	// convention that B2 and its tools use.  LastModified is only parsed from
+	// the default key; values stored under other keys are returned in Info.
+	LastModifiedKey string
+
+	// LastModifiedUnit is the resolution with which LastModified is saved on
+	// upload, e.g. time.Second to store seconds since the epoch.  The default
+	// is time.Millisecond.
+	LastModifiedUnit time.Duration
 }
 
 // Name returns an object's name
@@ -443,16 +887,34 @@ func (o *Object) ID() string {
 	return o.f.id()
 }
 
-// Attrs returns an object's attributes.
+// Attrs returns an object's attributes.  They are fetched with
+// b2_get_file_info unless they came with the object, as they do for objects
+// from a listing, and are kept, so that later calls make no request.  Writing
+// the object replaces the cached attributes with those of the new version.
 func (o *Object) Attrs(ctx context.Context) (*Attrs, error) {
 	if err := o.ensure(ctx); err != nil {
 		return nil, err
 	}
-	fi, err := o.f.getFileInfo(ctx)
-	if err != nil {
-		return nil, err
+	o.amu.Lock()
+	defer o.amu.Unlock()
+	if o.attrs == nil || o.attrsF != o.f {
+		fi, err := o.f.getFileInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		attrs, err := fileAttrs(fi)
+		if err != nil {
+			return nil, err
+		}
+		o.attrs, o.attrsF = attrs, o.f
 	}
-	name, sha, size, ct, info, st, stamp := fi.stats()
+	attrs := *o.attrs
+	attrs.Info = copyInfo(o.attrs.Info)
+	return &attrs, nil
+}
+
+func fileAttrs(fi beFileInfoInterface) (*Attrs, error) {
+	name, sha, size, ct, fileInfo, st, stamp := fi.stats()
 	var state ObjectState
 	switch st {
 	case "upload":
@@ -464,6 +926,9 @@ func (o *Object) Attrs(ctx context.Context) (*Attrs, error) {
 	case "folder":
 		state = Folder
 	}
+	// The info map may belong to the file, so it is copied before the
+	// last-modified key is taken out.
+	info := copyInfo(fileInfo)
 	var mtime time.Time
 	if v, ok := info["src_last_modified_millis"]; ok {
 		ms, err := strconv.ParseInt(v, 10, 64)
@@ -488,6 +953,17 @@ func (o *Object) Attrs(ctx context.Context) (*Attrs, error) {
 	}, nil
 }
 
+func copyInfo(info map[string]string) map[string]string {
+	if info == nil {
+		return nil
+	}
+	m := make(map[string]string, len(info))
+	for k, v := range info {
+		m[k] = v
+	}
+	return m
+}
+
 // ObjectState represents the various states an object can be in.
 type ObjectState int
 
@@ -525,12 +1001,24 @@ func (o *Object) URL() string {
 // NewWriter returns a new writer for the given object.  Objects that are
 // overwritten are not deleted, but are "hidden".
 //
+// The writer's requests, and the goroutines that make them, use a context
+// derived from ctx.  Cancelling ctx abandons the upload: a Write blocked on
+// sending a part returns, and Close returns ctx's error without uploading
+// anything more.  If a large file had been started, Close also makes a
+// best-effort attempt to cancel it, so that its parts are not left on B2,
+// unless Resume or LeaveUnfinished is set; it does the same if the upload
+// fails.  Close's error is always the upload's, not the cancellation's.  The
+// writer's fields and attributes must not be changed after the first call to
+// Write.
+//
 // Callers must close the writer when finished and check the error status.
 func (o *Object) NewWriter(ctx context.Context, opts ...WriterOption) *Writer {
+	pctx := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	w := &Writer{
 		o:      o,
 		name:   o.name,
+		parent: pctx,
 		ctx:    ctx,
 		cancel: cancel,
 	}
@@ -546,8 +1034,14 @@ func (o *Object) NewWriter(ctx context.Context, opts ...WriterOption) *Writer {
 // NewRangeReader returns a reader for the given object, reading up to length
 // bytes.  If length is negative, the rest of the object is read.
 func (o *Object) NewRangeReader(ctx context.Context, offset, length int64) *Reader {
+	end := int64(-1)
+	if length >= 0 {
+		end = offset + length
+	}
+	pctx := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	return &Reader{
+		parent: pctx,
 		ctx:    ctx,
 		cancel: cancel,
 		o:      o,
@@ -555,6 +1049,8 @@ func (o *Object) NewRangeReader(ctx context.Context, offset, length int64) *Read
 		chunks: make(map[int]*rchunk),
 		length: length,
 		offset: offset,
+		end:    end,
+		size:   -1,
 	}
 }
 
@@ -563,6 +1059,32 @@ func (o *Object) NewReader(ctx context.Context) *Reader {
 	return o.NewRangeReader(ctx, 0, -1)
 }
 
+// DownloadByID returns a reader for the file version with the given ID, such
+// as one found by listing with ListHidden, even if its name now refers to a
+// newer version.  The reader works as one from Object.NewReader does,
+// including concurrent downloads, and its object's attributes are those of
+// that version; see also Client.FileInfoByID.
+//
+// B2 finds files by ID across the account, not within the bucket.  If the ID
+// does not exist, Read returns an error satisfying IsNotExist.  If the key is
+// restricted to another bucket, Read returns an error saying so.
+func (b *Bucket) DownloadByID(ctx context.Context, fileID string) *Reader {
+	return b.DownloadRangeByID(ctx, fileID, 0, -1)
+}
+
+// DownloadRangeByID is like DownloadByID, but reads up to length bytes
+// starting at offset, as NewRangeReader does.
+func (b *Bucket) DownloadRangeByID(ctx context.Context, fileID string, offset, length int64) *Reader {
+	o := &Object{
+		b: b,
+		f: b.b.file(fileID, ""),
+	}
+	r := o.NewRangeReader(ctx, offset, length)
+	r.name = fileID
+	r.id = fileID
+	return r
+}
+
 func (o *Object) ensure(ctx context.Context) error {
 	if o.f == nil {
 		f, err := o.b.getObject(ctx, o.name)
@@ -574,7 +1096,10 @@ func (o *Object) ensure(ctx context.Context) error {
 	return nil
 }
 
-// Delete removes the given object.
+// Delete removes the given object.  An object returned by an iterator refers
+// to one version, the one listed, and only that version is deleted; other
+// versions with the same name are unaffected.  If the version no longer
+// exists, the returned error satisfies IsNotExist.
 func (o *Object) Delete(ctx context.Context) error {
 	if err := o.ensure(ctx); err != nil {
 		return err
@@ -582,32 +1107,151 @@ func (o *Object) Delete(ctx context.Context) error {
 	return o.f.deleteFileVersion(ctx)
 }
 
-// Hide hides the object from name-based listing.
+// Hide hides the object from name-based listing, by adding a "hide marker"
+// as the object's newest version.  Unlike Delete, which removes a single
+// version for good, Hide removes nothing: every version is kept, can still be
+// listed with ListHidden, and is still billed for.  Bucket.Reveal undoes Hide
+// by deleting the marker; deleting the older versions as well, with Delete,
+// is what frees their storage.
+//
+// If the object is already hidden, the returned error satisfies
+// IsAlreadyHidden.
 func (o *Object) Hide(ctx context.Context) error {
+	if o.f != nil && o.f.status() == "hide" {
+		return o.alreadyHidden()
+	}
 	if err := o.ensure(ctx); err != nil {
+		if IsNotExist(err) {
+			// A hidden object can't be fetched by name.
+			if v, verr := o.b.newestVersion(ctx, o.name); verr == nil && v != nil && v.f.status() == "hide" {
+				return o.alreadyHidden()
+			}
+		}
 		return err
 	}
 	_, err := o.b.b.hideFile(ctx, o.name)
 	return err
 }
 
+func (o *Object) alreadyHidden() error {
+	return b2err{err: fmt.Errorf("b2: %s is already hidden", o.name), alreadyHidden: true}
+}
+
 // Reveal unhides (if hidden) the named object.  If there are multiple objects
 // of a given name, it will reveal the most recent.
 func (b *Bucket) Reveal(ctx context.Context, name string) error {
+	obj, err := b.newestVersion(ctx, name)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return b2err{err: fmt.Errorf("%s: not found", name), notFoundErr: true}
+	}
+	if obj.f.status() == "hide" {
+		return obj.Delete(ctx)
+	}
+	return nil
+}
+
+// newestVersion returns the newest version of the named object, which may be
+// a hide marker, or nil if there are none.
+func (b *Bucket) newestVersion(ctx context.Context, name string) (*Object, error) {
 	iter := b.List(ctx, ListPrefix(name), ListHidden())
 	for iter.Next() {
 		obj := iter.Object()
 		if obj.Name() == name {
-			if obj.f.status() == "hide" {
-				return obj.Delete(ctx)
-			}
-			return nil
+			return obj, nil
 		}
 		if obj.Name() > name {
 			break
 		}
 	}
-	return b2err{err: fmt.Errorf("%s: not found", name), notFoundErr: true}
+	return nil, iter.Err()
+}
+
+// WaitForObject polls the bucket's listing until the named object appears in
+// it, or until timeout elapses.  If fileID is not empty, WaitForObject waits
+// for the version with that file ID to be the name's newest version, which
+// may be a hide marker.  Otherwise it waits for the name's newest version to
+// be an object rather than a hide marker.  B2 is strongly consistent, and a
+// finished upload is normally listed at once; WaitForObject guards against
+// the rare delay, for instance in tests that list what they have just written.
+//
+// If the object does not appear in time, the returned error satisfies
+// IsNotExist.
+func (b *Bucket) WaitForObject(ctx context.Context, name, fileID string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	sleep := 100 * time.Millisecond
+	for {
+		ok, err := b.listed(ctx, name, fileID)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if err := sleepCtx(ctx, sleep); err != nil {
+			return b2err{
+				err:         fmt.Errorf("%s: not visible after %v", name, timeout),
+				notFoundErr: true,
+			}
+		}
+		sleep *= 2
+		if sleep > 2*time.Second {
+			sleep = 2 * time.Second
+		}
+	}
+}
+
+// deleteOlderVersions deletes every version of the object's name older than o
+// itself.  Listings return a name's versions newest first.
+func (o *Object) deleteOlderVersions(ctx context.Context) error {
+	id := o.f.id()
+	var found bool
+	iter := o.b.List(ctx, ListPrefix(o.name), ListHidden())
+	for iter.Next() {
+		obj := iter.Object()
+		if obj.Name() != o.name {
+			continue
+		}
+		if !found {
+			found = obj.f.id() == id
+			continue
+		}
+		if err := obj.Delete(ctx); err != nil && !IsNotExist(err) {
+			return fmt.Errorf("%s: deleting older version %s: %v", o.name, obj.f.id(), err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s: uploaded version %s is not listed; older versions were not deleted", o.name, id)
+	}
+	return nil
+}
+
+// listed reports whether the named object is listed.  If fileID is given, it
+// reports whether that version is listed, even if a newer one has replaced
+// it; otherwise, whether the name is visible, its newest version being an
+// upload rather than a hide marker.
+func (b *Bucket) listed(ctx context.Context, name, fileID string) (bool, error) {
+	opts := []ListOption{ListPrefix(name)}
+	if fileID != "" {
+		opts = append(opts, ListHidden())
+	}
+	iter := b.List(ctx, opts...)
+	for iter.Next() {
+		obj := iter.Object()
+		if obj.Name() != name {
+			continue
+		}
+		if fileID == "" || obj.f.id() == fileID {
+			return true, nil
+		}
+	}
+	return false, iter.Err()
 }
 
 // I don't want to import all of ioutil for this.
@@ -634,20 +1278,70 @@ func (b *Bucket) getObject(ctx context.Context, name string) (*Object, error) {
 
 // AuthToken returns an authorization token that can be used to access objects
 // in a private bucket.  Only objects that begin with prefix can be accessed.
-// The token expires after the given duration.
+// The token expires after the given duration, which B2 requires to be between
+// one second and a week.  See FriendlyURL to build download URLs with it.
 func (b *Bucket) AuthToken(ctx context.Context, prefix string, valid time.Duration) (string, error) {
+	if err := checkDownloadAuthorization(valid); err != nil {
+		return "", err
+	}
 	return b.b.getDownloadAuthorization(ctx, prefix, valid, "")
 }
 
+// FriendlyURL returns the URL from which the named object can be downloaded
+// with token, from AuthToken, e.g. by a browser.  It works only while the
+// token is valid, and only if name begins with the token's prefix.
+func (b *Bucket) FriendlyURL(name, token string) string {
+	return fmt.Sprintf("%s?Authorization=%s", b.Object(name).URL(), url.QueryEscape(token))
+}
+
+// maxDownloadAuthorization is the longest that B2 will let a download
+// authorization token last.
+const maxDownloadAuthorization = 7 * 24 * time.Hour
+
+func checkDownloadAuthorization(valid time.Duration) error {
+	if valid < time.Second || valid > maxDownloadAuthorization {
+		return fmt.Errorf("b2: download authorization lifetime %v must be between 1s and %v", valid, maxDownloadAuthorization)
+	}
+	return nil
+}
+
+// MakeObjectPublicURL returns a URL from which anyone may download the named
+// object for the next ttl, which must be between one second and a week.  B2
+// has no per-object permissions: a bucket is either public or private.  This
+// is the nearest equivalent to making a single object public.  In a private
+// bucket, the URL carries a download authorization token, as from AuthURL;
+// because B2 grants such tokens by prefix, the URL also works for any object
+// whose name begins with name.  In a public bucket the object's plain URL is
+// returned, and does not expire.
+func (b *Bucket) MakeObjectPublicURL(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	// Public buckets need no token, but the lifetime is checked anyway, so
+	// that callers don't come to rely on a bucket's type.
+	if err := checkDownloadAuthorization(ttl); err != nil {
+		return "", err
+	}
+	o := b.Object(name)
+	if b.b.btype() == Public {
+		return o.URL(), nil
+	}
+	u, err := o.AuthURL(ctx, ttl, "")
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
 // AuthURL returns a URL for the given object with embedded token and,
 // possibly, b2ContentDisposition arguments.  Leave b2cd blank for no content
 // disposition.
 func (o *Object) AuthURL(ctx context.Context, valid time.Duration, b2cd string) (*url.URL, error) {
+	if err := checkDownloadAuthorization(valid); err != nil {
+		return nil, err
+	}
 	token, err := o.b.b.getDownloadAuthorization(ctx, o.name, valid, b2cd)
 	if err != nil {
 		return nil, err
 	}
-	urlString := fmt.Sprintf("%s?Authorization=%s", o.URL(), url.QueryEscape(token))
+	urlString := o.b.FriendlyURL(o.name, token)
 	if b2cd != "" {
 		urlString = fmt.Sprintf("%s&b2ContentDisposition=%s", urlString, url.QueryEscape(b2cd))
 	}
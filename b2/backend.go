@@ -17,7 +17,7 @@ package b2
 import (
 	"context"
 	"io"
-	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -30,16 +30,34 @@ type beRootInterface interface {
 	reupload(error) bool
 	authorizeAccount(context.Context, string, string, clientOptions) error
 	reauthorizeAccount(context.Context) error
+	authGeneration() int
+	reauthorize(context.Context, int) error
 	createBucket(ctx context.Context, name, btype string, info map[string]string, rules []LifecycleRule) (beBucketInterface, error)
 	listBuckets(context.Context, string) ([]beBucketInterface, error)
 	createKey(context.Context, string, []string, time.Duration, string, string) (beKeyInterface, error)
 	listKeys(context.Context, int, string) ([]beKeyInterface, string, error)
+	deleteKey(context.Context, string) error
+	allowedBucket() (string, string)
+	allowance() ([]string, string)
+	s3APIURL() string
+	rawAuthInfo() map[string]interface{}
+	credentials() (string, string)
+	tracer() Tracer
+	retryPolicy() RetryPolicy
+	jitter(time.Duration) time.Duration
+	publicBucket(string, string) beBucketInterface
+	bucket(string, string) beBucketInterface
+	fileByID(context.Context, string) (beFileInterface, string, error)
+	downloadFileByID(context.Context, string, int64, int64, bool) (beFileReaderInterface, error)
 }
 
 type beRoot struct {
 	account, key string
 	b2i          b2RootInterface
 	options      clientOptions
+
+	amu  sync.Mutex // serializes reauthorization
+	agen int        // the number of times the account has been reauthorized
 }
 
 type beBucketInterface interface {
@@ -71,8 +89,9 @@ type beURLInterface interface {
 }
 
 type beURL struct {
-	b2url b2URLInterface
-	ri    beRootInterface
+	b2url  b2URLInterface
+	ri     beRootInterface
+	bucket string
 }
 
 type beFileInterface interface {
@@ -85,23 +104,29 @@ type beFileInterface interface {
 	getFileInfo(context.Context) (beFileInfoInterface, error)
 	listParts(context.Context, int, int) ([]beFilePartInterface, int, error)
 	compileParts(int64, map[int]string) beLargeFileInterface
+	copyFile(context.Context, *copyRequest) (beFileInterface, error)
 }
 
 type beFile struct {
 	b2file b2FileInterface
 	url    beURLInterface
 	ri     beRootInterface
+	bucket string // the bucket's name, for tracing, if known
 }
 
 type beLargeFileInterface interface {
 	finishLargeFile(context.Context) (beFileInterface, error)
 	getUploadPartURL(context.Context) (beFileChunkInterface, error)
+	copyPart(context.Context, string, string, int) (int64, string, error)
 	cancel(context.Context) error
+	id() string
 }
 
 type beLargeFile struct {
 	b2largeFile b2LargeFileInterface
 	ri          beRootInterface
+	bucket      string
+	name        string
 }
 
 type beFileChunkInterface interface {
@@ -112,12 +137,15 @@ type beFileChunkInterface interface {
 type beFileChunk struct {
 	b2fileChunk b2FileChunkInterface
 	ri          beRootInterface
+	bucket      string
+	name        string
 }
 
 type beFileReaderInterface interface {
 	io.ReadCloser
 	stats() (int, string, string, map[string]string)
 	id() string
+	uploaded() time.Time
 }
 
 type beFileReader struct {
@@ -164,26 +192,130 @@ type beKey struct {
 	k   b2KeyInterface
 }
 
-func (r *beRoot) backoff(err error) time.Duration { return r.b2i.backoff(err) }
-func (r *beRoot) reauth(err error) bool           { return r.b2i.reauth(err) }
-func (r *beRoot) reupload(err error) bool         { return r.b2i.reupload(err) }
-func (r *beRoot) transient(err error) bool        { return r.b2i.transient(err) }
+func (r *beRoot) backoff(err error) time.Duration     { return r.b2i.backoff(err) }
+func (r *beRoot) reauth(err error) bool               { return r.b2i.reauth(err) }
+func (r *beRoot) reupload(err error) bool             { return r.b2i.reupload(err) }
+func (r *beRoot) transient(err error) bool            { return r.b2i.transient(err) }
+func (r *beRoot) allowedBucket() (string, string)     { return r.b2i.allowedBucket() }
+func (r *beRoot) allowance() ([]string, string)       { return r.b2i.allowance() }
+func (r *beRoot) s3APIURL() string                    { return r.b2i.s3APIURL() }
+func (r *beRoot) rawAuthInfo() map[string]interface{} { return r.b2i.rawAuthInfo() }
+func (r *beRoot) credentials() (string, string)       { return r.account, r.key }
+func (r *beRoot) tracer() Tracer                      { return r.options.tracer }
+func (r *beRoot) retryPolicy() RetryPolicy            { return r.options.retryPolicy }
 
-func (r *beRoot) authorizeAccount(ctx context.Context, account, key string, c clientOptions) error {
+func (r *beRoot) jitter(d time.Duration) time.Duration {
+	return r.options.jitter.equal(d)
+}
+
+func (r *beRoot) publicBucket(name, downloadURL string) beBucketInterface {
+	return &beBucket{
+		b2bucket: r.b2i.publicBucket(name, downloadURL),
+		ri:       r,
+	}
+}
+
+func (r *beRoot) bucket(id, name string) beBucketInterface {
+	return &beBucket{
+		b2bucket: r.b2i.bucket(id, name),
+		ri:       r,
+	}
+}
+
+func (r *beRoot) fileByID(ctx context.Context, id string) (beFileInterface, string, error) {
+	var file beFileInterface
+	var bucketID string
 	f := func() error {
-		if err := r.b2i.authorizeAccount(ctx, account, key, c); err != nil {
-			return err
+		g := func() error {
+			f, bid, err := r.b2i.fileByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			file = &beFile{
+				b2file: f,
+				ri:     r,
+			}
+			bucketID = bid
+			return nil
 		}
-		r.account = account
-		r.key = key
-		r.options = c
-		return nil
+		return withReauth(ctx, r, g)
 	}
-	return withBackoff(ctx, r, f)
+	if err := withBackoff(ctx, r, f); err != nil {
+		return nil, "", err
+	}
+	return file, bucketID, nil
+}
+
+func (r *beRoot) downloadFileByID(ctx context.Context, id string, offset, size int64, header bool) (beFileReaderInterface, error) {
+	ctx, sp := startOp(ctx, r, Op{API: "b2_download_file_by_id", Size: size})
+	var reader beFileReaderInterface
+	f := func() error {
+		g := func() error {
+			fr, err := r.b2i.downloadFileByID(ctx, id, offset, size, header)
+			if err != nil {
+				return err
+			}
+			reader = &beFileReader{
+				b2fileReader: fr,
+				ri:           r,
+			}
+			return nil
+		}
+		return withReauth(ctx, r, g)
+	}
+	err := withBackoff(ctx, r, f)
+	sp.End(err)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *beRoot) authorizeAccount(ctx context.Context, account, key string, c clientOptions) error {
+	r.account = account
+	r.key = key
+	r.options = c
+	return r.authorize(ctx)
+}
+
+// authorize gets a new token with the credentials and options given to
+// authorizeAccount.  Those are set once, before the client is used, and are
+// only read after that, so operations can read them without a lock while
+// another one reauthorizes.
+func (r *beRoot) authorize(ctx context.Context) error {
+	ctx, sp := startOp(ctx, r, Op{API: "b2_authorize_account"})
+	f := func() error {
+		return r.b2i.authorizeAccount(ctx, r.account, r.key, r.options)
+	}
+	err := withBackoff(ctx, r, f)
+	sp.End(err)
+	return err
 }
 
 func (r *beRoot) reauthorizeAccount(ctx context.Context) error {
-	return r.authorizeAccount(ctx, r.account, r.key, r.options)
+	return r.reauthorize(ctx, r.authGeneration())
+}
+
+func (r *beRoot) authGeneration() int {
+	r.amu.Lock()
+	defer r.amu.Unlock()
+	return r.agen
+}
+
+// reauthorize authorizes the account again, unless that has been done since
+// generation gen.  Calls whose tokens expire together so wait for a single
+// b2_authorize_account, and then use the token it got.
+func (r *beRoot) reauthorize(ctx context.Context, gen int) error {
+	r.amu.Lock()
+	defer r.amu.Unlock()
+	if r.agen != gen {
+		return nil
+	}
+	if err := r.authorize(ctx); err != nil {
+		return err
+	}
+	r.agen++
+	return nil
 }
 
 func (r *beRoot) createBucket(ctx context.Context, name, btype string, info map[string]string, rules []LifecycleRule) (beBucketInterface, error) {
@@ -280,6 +412,16 @@ func (r *beRoot) listKeys(ctx context.Context, max int, next string) ([]beKeyInt
 	return keys, cur, nil
 }
 
+func (r *beRoot) deleteKey(ctx context.Context, id string) error {
+	f := func() error {
+		g := func() error {
+			return r.b2i.deleteKey(ctx, id)
+		}
+		return withReauth(ctx, r, g)
+	}
+	return withBackoff(ctx, r, f)
+}
+
 func (b *beBucket) name() string        { return b.b2bucket.name() }
 func (b *beBucket) btype() BucketType   { return BucketType(b.b2bucket.btype()) }
 func (b *beBucket) attrs() *BucketAttrs { return b.b2bucket.attrs() }
@@ -314,8 +456,9 @@ func (b *beBucket) getUploadURL(ctx context.Context) (beURLInterface, error) {
 				return err
 			}
 			url = &beURL{
-				b2url: u,
-				ri:    b.ri,
+				b2url:  u,
+				ri:     b.ri,
+				bucket: b.name(),
 			}
 			return nil
 		}
@@ -338,6 +481,8 @@ func (b *beBucket) startLargeFile(ctx context.Context, name, ct string, info map
 			file = &beLargeFile{
 				b2largeFile: f,
 				ri:          b.ri,
+				bucket:      b.name(),
+				name:        name,
 			}
 			return nil
 		}
@@ -350,6 +495,7 @@ func (b *beBucket) startLargeFile(ctx context.Context, name, ct string, info map
 }
 
 func (b *beBucket) listFileNames(ctx context.Context, count int, continuation, prefix, delimiter string) ([]beFileInterface, string, error) {
+	ctx, sp := startOp(ctx, b.ri, Op{API: "b2_list_file_names", Bucket: b.name(), Name: prefix})
 	var cont string
 	var files []beFileInterface
 	f := func() error {
@@ -363,19 +509,23 @@ func (b *beBucket) listFileNames(ctx context.Context, count int, continuation, p
 				files = append(files, &beFile{
 					b2file: f,
 					ri:     b.ri,
+					bucket: b.name(),
 				})
 			}
 			return nil
 		}
 		return withReauth(ctx, b.ri, g)
 	}
-	if err := withBackoff(ctx, b.ri, f); err != nil {
+	err := withBackoff(ctx, b.ri, f)
+	sp.End(err)
+	if err != nil {
 		return nil, "", err
 	}
 	return files, cont, nil
 }
 
 func (b *beBucket) listFileVersions(ctx context.Context, count int, nextName, nextID, prefix, delimiter string) ([]beFileInterface, string, string, error) {
+	ctx, sp := startOp(ctx, b.ri, Op{API: "b2_list_file_versions", Bucket: b.name(), Name: prefix})
 	var name, id string
 	var files []beFileInterface
 	f := func() error {
@@ -390,13 +540,16 @@ func (b *beBucket) listFileVersions(ctx context.Context, count int, nextName, ne
 				files = append(files, &beFile{
 					b2file: f,
 					ri:     b.ri,
+					bucket: b.name(),
 				})
 			}
 			return nil
 		}
 		return withReauth(ctx, b.ri, g)
 	}
-	if err := withBackoff(ctx, b.ri, f); err != nil {
+	err := withBackoff(ctx, b.ri, f)
+	sp.End(err)
+	if err != nil {
 		return nil, "", "", err
 	}
 	return files, name, id, nil
@@ -416,6 +569,7 @@ func (b *beBucket) listUnfinishedLargeFiles(ctx context.Context, count int, cont
 				files = append(files, &beFile{
 					b2file: f,
 					ri:     b.ri,
+					bucket: b.name(),
 				})
 			}
 			return nil
@@ -429,6 +583,7 @@ func (b *beBucket) listUnfinishedLargeFiles(ctx context.Context, count int, cont
 }
 
 func (b *beBucket) downloadFileByName(ctx context.Context, name string, offset, size int64, header bool) (beFileReaderInterface, error) {
+	ctx, sp := startOp(ctx, b.ri, Op{API: "b2_download_file_by_name", Bucket: b.name(), Name: name, Size: size})
 	var reader beFileReaderInterface
 	f := func() error {
 		g := func() error {
@@ -444,7 +599,9 @@ func (b *beBucket) downloadFileByName(ctx context.Context, name string, offset,
 		}
 		return withReauth(ctx, b.ri, g)
 	}
-	if err := withBackoff(ctx, b.ri, f); err != nil {
+	err := withBackoff(ctx, b.ri, f)
+	sp.End(err)
+	if err != nil {
 		return nil, err
 	}
 	return reader, nil
@@ -461,6 +618,7 @@ func (b *beBucket) hideFile(ctx context.Context, name string) (beFileInterface,
 			file = &beFile{
 				b2file: f,
 				ri:     b.ri,
+				bucket: b.name(),
 			}
 			return nil
 		}
@@ -499,10 +657,12 @@ func (b *beBucket) file(id, name string) beFileInterface {
 	return &beFile{
 		b2file: b.b2bucket.file(id, name),
 		ri:     b.ri,
+		bucket: b.name(),
 	}
 }
 
 func (b *beURL) uploadFile(ctx context.Context, r readResetter, size int, name, ct, sha1 string, info map[string]string) (beFileInterface, error) {
+	ctx, sp := startOp(ctx, b.ri, Op{API: "b2_upload_file", Bucket: b.bucket, Name: name, Size: int64(size)})
 	var file beFileInterface
 	f := func() error {
 		if err := r.Reset(); err != nil {
@@ -516,10 +676,13 @@ func (b *beURL) uploadFile(ctx context.Context, r readResetter, size int, name,
 			b2file: f,
 			url:    b,
 			ri:     b.ri,
+			bucket: b.bucket,
 		}
 		return nil
 	}
-	if err := withBackoff(ctx, b.ri, f); err != nil {
+	err := withBackoff(ctx, b.ri, f)
+	sp.End(err)
+	if err != nil {
 		return nil, err
 	}
 	return file, nil
@@ -613,9 +776,33 @@ func (b *beFile) compileParts(size int64, seen map[int]string) beLargeFileInterf
 	return &beLargeFile{
 		b2largeFile: b.b2file.compileParts(size, seen),
 		ri:          b.ri,
+		bucket:      b.bucket,
+		name:        b.name(),
 	}
 }
 
+func (b *beFile) copyFile(ctx context.Context, req *copyRequest) (beFileInterface, error) {
+	var file beFileInterface
+	f := func() error {
+		g := func() error {
+			f, err := b.b2file.copyFile(ctx, req)
+			if err != nil {
+				return err
+			}
+			file = &beFile{
+				b2file: f,
+				ri:     b.ri,
+			}
+			return nil
+		}
+		return withReauth(ctx, b.ri, g)
+	}
+	if err := withBackoff(ctx, b.ri, f); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
 func (b *beLargeFile) getUploadPartURL(ctx context.Context) (beFileChunkInterface, error) {
 	var chunk beFileChunkInterface
 	f := func() error {
@@ -627,6 +814,8 @@ func (b *beLargeFile) getUploadPartURL(ctx context.Context) (beFileChunkInterfac
 			chunk = &beFileChunk{
 				b2fileChunk: fc,
 				ri:          b.ri,
+				bucket:      b.bucket,
+				name:        b.name,
 			}
 			return nil
 		}
@@ -649,6 +838,7 @@ func (b *beLargeFile) finishLargeFile(ctx context.Context) (beFileInterface, err
 			file = &beFile{
 				b2file: f,
 				ri:     b.ri,
+				bucket: b.bucket,
 			}
 			return nil
 		}
@@ -660,6 +850,26 @@ func (b *beLargeFile) finishLargeFile(ctx context.Context) (beFileInterface, err
 	return file, nil
 }
 
+func (b *beLargeFile) copyPart(ctx context.Context, srcID, rng string, index int) (int64, string, error) {
+	var size int64
+	var sha string
+	f := func() error {
+		g := func() error {
+			n, s, err := b.b2largeFile.copyPart(ctx, srcID, rng, index)
+			if err != nil {
+				return err
+			}
+			size, sha = n, s
+			return nil
+		}
+		return withReauth(ctx, b.ri, g)
+	}
+	if err := withBackoff(ctx, b.ri, f); err != nil {
+		return 0, "", err
+	}
+	return size, sha, nil
+}
+
 func (b *beLargeFile) cancel(ctx context.Context) error {
 	f := func() error {
 		g := func() error {
@@ -670,6 +880,10 @@ func (b *beLargeFile) cancel(ctx context.Context) error {
 	return withBackoff(ctx, b.ri, f)
 }
 
+func (b *beLargeFile) id() string {
+	return b.b2largeFile.id()
+}
+
 func (b *beFileChunk) reload(ctx context.Context) error {
 	f := func() error {
 		g := func() error {
@@ -683,6 +897,7 @@ func (b *beFileChunk) reload(ctx context.Context) error {
 func (b *beFileChunk) uploadPart(ctx context.Context, r readResetter, sha1 string, size, index int) (int, error) {
 	// no re-auth; pass it back up to the caller so they can get an new upload URI and token
 	// TODO: we should handle that here probably
+	ctx, sp := startOp(ctx, b.ri, Op{API: "b2_upload_part", Bucket: b.bucket, Name: b.name, Size: int64(size), Part: index})
 	var i int
 	f := func() error {
 		if err := r.Reset(); err != nil {
@@ -695,7 +910,9 @@ func (b *beFileChunk) uploadPart(ctx context.Context, r readResetter, sha1 strin
 		i = j
 		return nil
 	}
-	if err := withBackoff(ctx, b.ri, f); err != nil {
+	err := withBackoff(ctx, b.ri, f)
+	sp.End(err)
+	if err != nil {
 		return 0, err
 	}
 	return i, nil
@@ -715,6 +932,8 @@ func (b *beFileReader) stats() (int, string, string, map[string]string) {
 
 func (b *beFileReader) id() string { return b.b2fileReader.id() }
 
+func (b *beFileReader) uploaded() time.Time { return b.b2fileReader.uploaded() }
+
 func (b *beFileInfo) stats() (string, string, int64, string, map[string]string, string, time.Time) {
 	return b.name, b.sha, b.size, b.ct, b.info, b.status, b.stamp
 }
@@ -730,47 +949,57 @@ func (b *beKey) expires() time.Time            { return b.k.expires() }
 func (b *beKey) secret() string                { return b.k.secret() }
 func (b *beKey) id() string                    { return b.k.id() }
 
-func jitter(d time.Duration) time.Duration {
-	f := float64(d)
-	f /= 50
-	f += f * (rand.Float64() - 0.5)
-	return time.Duration(f)
-}
-
+// getBackoff returns the backoff after one of d: twice as long, up to 30s.
 func getBackoff(d time.Duration) time.Duration {
-	if d > 30*time.Second {
-		return 30*time.Second + jitter(d)
+	if d *= 2; d > 30*time.Second {
+		return 30 * time.Second
 	}
-	return d*2 + jitter(d*2)
+	return d
 }
 
 var after = time.After
 
 func withBackoff(ctx context.Context, ri beRootInterface, f func() error) error {
 	backoff := 500 * time.Millisecond
-	for {
+	for attempt := 1; ; attempt++ {
 		err := f()
 		if !ri.transient(err) {
 			return err
 		}
 		bo := ri.backoff(err)
-		if bo > 0 {
+		var wait time.Duration
+		if p := ri.retryPolicy(); p != nil {
+			retry, d := p.ShouldRetry(attempt, err)
+			if !retry {
+				return err
+			}
+			wait = d
+			if bo > wait {
+				wait = bo
+			}
+		} else if bo > 0 {
 			backoff = bo
+			wait = bo
 		} else {
 			backoff = getBackoff(backoff)
+			wait = ri.jitter(backoff)
 		}
+		retried(ctx, err)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-after(backoff):
+		case <-after(wait):
 		}
 	}
 }
 
+// withReauth calls f, and if it fails because the account's token has
+// expired, reauthorizes the account and calls f once more.
 func withReauth(ctx context.Context, ri beRootInterface, f func() error) error {
+	gen := ri.authGeneration()
 	err := f()
 	if ri.reauth(err) {
-		if err := ri.reauthorizeAccount(ctx); err != nil {
+		if err := ri.reauthorize(ctx, gen); err != nil {
 			return err
 		}
 		err = f()
@@ -16,11 +16,13 @@ package b2
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
 
 	"github.com/kurin/blazer/base"
+	"github.com/kurin/blazer/internal/blog"
 )
 
 // This file wraps the base package in a thin layer, for testing.  It should be
@@ -36,6 +38,15 @@ type b2RootInterface interface {
 	listBuckets(context.Context, string) ([]b2BucketInterface, error)
 	createKey(context.Context, string, []string, time.Duration, string, string) (b2KeyInterface, error)
 	listKeys(context.Context, int, string) ([]b2KeyInterface, string, error)
+	deleteKey(context.Context, string) error
+	allowedBucket() (string, string)
+	allowance() ([]string, string)
+	s3APIURL() string
+	rawAuthInfo() map[string]interface{}
+	publicBucket(string, string) b2BucketInterface
+	bucket(string, string) b2BucketInterface
+	fileByID(context.Context, string) (b2FileInterface, string, error)
+	downloadFileByID(context.Context, string, int64, int64, bool) (b2FileReaderInterface, error)
 }
 
 type b2BucketInterface interface {
@@ -72,12 +83,15 @@ type b2FileInterface interface {
 	getFileInfo(context.Context) (b2FileInfoInterface, error)
 	listParts(context.Context, int, int) ([]b2FilePartInterface, int, error)
 	compileParts(int64, map[int]string) b2LargeFileInterface
+	copyFile(context.Context, *copyRequest) (b2FileInterface, error)
 }
 
 type b2LargeFileInterface interface {
 	finishLargeFile(context.Context) (b2FileInterface, error)
 	getUploadPartURL(context.Context) (b2FileChunkInterface, error)
+	copyPart(context.Context, string, string, int) (int64, string, error)
 	cancel(context.Context) error
+	id() string
 }
 
 type b2FileChunkInterface interface {
@@ -89,6 +103,7 @@ type b2FileReaderInterface interface {
 	io.ReadCloser
 	stats() (int, string, string, map[string]string)
 	id() string
+	uploaded() time.Time
 }
 
 type b2FileInfoInterface interface {
@@ -156,6 +171,9 @@ func (b *b2Root) authorizeAccount(ctx context.Context, account, key string, c cl
 	if c.transport != nil {
 		ct.rt = c.transport
 	}
+	if c.httpClient != nil {
+		ct.rt = httpClientTransport{c: c.httpClient}
+	}
 	aopts = append(aopts, base.Transport(ct))
 	if c.failSomeUploads {
 		aopts = append(aopts, base.FailSomeUploads())
@@ -166,13 +184,23 @@ func (b *b2Root) authorizeAccount(ctx context.Context, account, key string, c cl
 	if c.capExceeded {
 		aopts = append(aopts, base.ForceCapExceeded())
 	}
-	if c.apiBase != "" {
-		aopts = append(aopts, base.SetAPIBase(c.apiBase))
-	}
 	for _, agent := range c.userAgents {
 		aopts = append(aopts, base.UserAgent(agent))
 	}
-	nb, err := base.AuthorizeAccount(ctx, account, key, aopts...)
+	bases := append([]string{c.apiBase}, c.altAPIBases...)
+	var nb *base.B2
+	var err error
+	for i, api := range bases {
+		opts := append([]base.AuthOption(nil), aopts...)
+		if api != "" {
+			opts = append(opts, base.SetAPIBase(api))
+		}
+		nb, err = base.AuthorizeAccount(ctx, account, key, opts...)
+		if err == nil || i == len(bases)-1 || !unreachable(ctx, err) {
+			break
+		}
+		blog.V(1).Infof("b2: authorizing against %q: %v; trying %q", api, err, bases[i+1])
+	}
 	if err != nil {
 		return err
 	}
@@ -184,11 +212,22 @@ func (b *b2Root) authorizeAccount(ctx context.Context, account, key string, c cl
 	return nil
 }
 
+// unreachable reports whether an authorization error means that the API
+// endpoint could not be reached, rather than that it refused the request.
+func unreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	code, _ := base.Code(err)
+	return code == 0 || code >= 500
+}
+
 func (*b2Root) backoff(err error) time.Duration {
-	if base.Action(err) != base.Retry {
-		return 0
+	switch base.Action(err) {
+	case base.Retry, base.AttemptNewUpload:
+		return base.Backoff(err)
 	}
-	return base.Backoff(err)
+	return 0
 }
 
 func (*b2Root) reauth(err error) bool {
@@ -252,6 +291,9 @@ func (b *b2Bucket) updateBucket(ctx context.Context, attrs *BucketAttrs) error {
 		}
 		b.b.LifecycleRules = rules
 	}
+	if attrs.Replication != nil {
+		b.b.Replication = replicationToBase(attrs.Replication)
+	}
 	newBucket, err := b.b.Update(ctx)
 	if err == nil {
 		b.b = newBucket
@@ -286,6 +328,34 @@ func (b *b2Root) listKeys(ctx context.Context, max int, next string) ([]b2KeyInt
 	return k, next, nil
 }
 
+func (b *b2Root) deleteKey(ctx context.Context, id string) error {
+	return b.b.DeleteKey(ctx, id)
+}
+
+func (b *b2Root) allowedBucket() (string, string) {
+	return b.b.AllowedBucket()
+}
+
+func (b *b2Root) allowance() ([]string, string) {
+	return b.b.Allowance()
+}
+
+func (b *b2Root) s3APIURL() string {
+	return b.b.S3APIURL()
+}
+
+func (b *b2Root) rawAuthInfo() map[string]interface{} {
+	return b.b.RawAuthInfo()
+}
+
+func (b *b2Root) publicBucket(name, downloadURL string) b2BucketInterface {
+	return &b2Bucket{b.b.PublicBucket(name, downloadURL)}
+}
+
+func (b *b2Root) bucket(id, name string) b2BucketInterface {
+	return &b2Bucket{b.b.Bucket(id, name)}
+}
+
 func (b *b2Bucket) deleteBucket(ctx context.Context) error {
 	return b.b.DeleteBucket(ctx)
 }
@@ -307,11 +377,93 @@ func (b *b2Bucket) attrs() *BucketAttrs {
 			Prefix:                 rule.Prefix,
 		})
 	}
+	var cors []CORSRule
+	for _, rule := range b.b.CORSRules {
+		cors = append(cors, CORSRule{
+			Name:              rule.Name,
+			AllowedOrigins:    rule.AllowedOrigins,
+			AllowedOperations: rule.AllowedOperations,
+			AllowedHeaders:    rule.AllowedHeaders,
+			ExposeHeaders:     rule.ExposeHeaders,
+			MaxAge:            time.Duration(rule.MaxAgeSeconds) * time.Second,
+		})
+	}
+	var lock *ObjectLockConfiguration
+	if fl := b.b.FileLock; fl != nil {
+		lock = &ObjectLockConfiguration{
+			Readable:      fl.Readable,
+			Enabled:       fl.Enabled,
+			DefaultMode:   fl.RetentionMode,
+			DefaultPeriod: fl.RetentionPeriod,
+			DefaultUnit:   fl.RetentionUnit,
+		}
+	}
 	return &BucketAttrs{
 		LifecycleRules: rules,
 		Info:           b.b.Info,
 		Type:           BucketType(b.b.Type),
+		Replication:    replicationFromBase(b.b.Replication),
+		CORSRules:      cors,
+		ObjectLock:     lock,
+	}
+}
+
+func encryptionToBase(e *Encryption) *base.ServerSideEncryption {
+	if e == nil {
+		return nil
+	}
+	return &base.ServerSideEncryption{
+		Mode: string(e.Mode),
+		Key:  e.Key,
+	}
+}
+
+func replicationToBase(rc *ReplicationConfiguration) *base.ReplicationConfiguration {
+	brc := &base.ReplicationConfiguration{}
+	if src := rc.Source; src != nil {
+		brc.IsSource = true
+		brc.SourceKeyID = src.KeyID
+		for _, rule := range src.Rules {
+			brc.SourceRules = append(brc.SourceRules, base.ReplicationRule{
+				Name:                rule.Name,
+				DestinationBucketID: rule.DestinationBucketID,
+				Prefix:              rule.Prefix,
+				Priority:            rule.Priority,
+				Enabled:             rule.Enabled,
+				IncludeExisting:     rule.IncludeExisting,
+			})
+		}
+	}
+	if dst := rc.Destination; dst != nil {
+		brc.IsDestination = true
+		brc.KeyMapping = dst.KeyMapping
+	}
+	return brc
+}
+
+func replicationFromBase(brc *base.ReplicationConfiguration) *ReplicationConfiguration {
+	if brc == nil || (!brc.IsSource && !brc.IsDestination) {
+		return nil
+	}
+	rc := &ReplicationConfiguration{}
+	if brc.IsSource {
+		src := &ReplicationSource{KeyID: brc.SourceKeyID}
+		for _, rule := range brc.SourceRules {
+			src.Rules = append(src.Rules, ReplicationRule{
+				Name:                rule.Name,
+				DestinationBucketID: rule.DestinationBucketID,
+				Prefix:              rule.Prefix,
+				Priority:            rule.Priority,
+				Enabled:             rule.Enabled,
+				IncludeExisting:     rule.IncludeExisting,
+			})
+		}
+		rc.Source = src
 	}
+	if brc.IsDestination {
+		rc.Destination = &ReplicationDestination{KeyMapping: brc.KeyMapping}
+	}
+	return rc
 }
 
 func (b *b2Bucket) id() string { return b.b.ID }
@@ -386,6 +538,9 @@ func (b *b2Bucket) downloadFileByName(ctx context.Context, name string, offset,
 func (b *b2Bucket) hideFile(ctx context.Context, name string) (b2FileInterface, error) {
 	f, err := b.b.HideFile(ctx, name)
 	if err != nil {
+		if _, msgCode, _ := base.MsgCode(err); msgCode == "already_hidden" {
+			return nil, b2err{err: err, alreadyHidden: true}
+		}
 		return nil, err
 	}
 	return &b2File{f}, nil
@@ -414,7 +569,15 @@ func (b *b2URL) reload(ctx context.Context) error {
 }
 
 func (b *b2File) deleteFileVersion(ctx context.Context) error {
-	return b.b.DeleteFileVersion(ctx)
+	err := b.b.DeleteFileVersion(ctx)
+	if err == nil {
+		return nil
+	}
+	code, msgCode, _ := base.MsgCode(err)
+	if code == http.StatusNotFound || msgCode == "file_not_present" {
+		return b2err{err: err, notFoundErr: true}
+	}
+	return err
 }
 
 func (b *b2File) name() string {
@@ -437,6 +600,33 @@ func (b *b2File) status() string {
 	return b.b.Status
 }
 
+func (b *b2Root) fileByID(ctx context.Context, id string) (b2FileInterface, string, error) {
+	f := b.b.File(id)
+	fi, err := f.GetFileInfo(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return &b2File{f}, fi.BucketID, nil
+}
+
+func (b *b2Root) downloadFileByID(ctx context.Context, id string, offset, size int64, header bool) (b2FileReaderInterface, error) {
+	fr, err := b.b.DownloadFileByID(ctx, id, offset, size, header)
+	if err != nil {
+		code, msgCode, _ := base.MsgCode(err)
+		switch {
+		case code == http.StatusRequestedRangeNotSatisfiable:
+			return nil, errNoMoreContent
+		case code == http.StatusNotFound:
+			return nil, b2err{err: fmt.Errorf("b2: file ID %s: not found: %v", id, err), notFoundErr: true}
+		case code == http.StatusUnauthorized && msgCode == "unauthorized":
+			// The token is good, but not for this file.
+			return nil, fmt.Errorf("b2: file ID %s: not readable with this key; it may be in a bucket the key is restricted from: %v", id, err)
+		}
+		return nil, err
+	}
+	return &b2FileReader{fr}, nil
+}
+
 func (b *b2File) getFileInfo(ctx context.Context) (b2FileInfoInterface, error) {
 	if b.b.Info != nil {
 		return &b2FileInfo{b.b.Info}, nil
@@ -464,6 +654,18 @@ func (b *b2File) compileParts(size int64, seen map[int]string) b2LargeFileInterf
 	return &b2LargeFile{b.b.CompileParts(size, seen)}
 }
 
+func (b *b2File) copyFile(ctx context.Context, req *copyRequest) (b2FileInterface, error) {
+	f, err := b.b.CopyFile(ctx, req.name, req.rng, req.bucketID, req.directive, req.contentType, req.info, encryptionToBase(req.dstEnc), encryptionToBase(req.srcEnc))
+	if err != nil {
+		code, msgCode, _ := base.MsgCode(err)
+		if code == http.StatusNotFound || msgCode == "file_not_present" {
+			return nil, b2err{err: err, notFoundErr: true}
+		}
+		return nil, err
+	}
+	return &b2File{f}, nil
+}
+
 func (b *b2LargeFile) finishLargeFile(ctx context.Context) (b2FileInterface, error) {
 	f, err := b.b.FinishLargeFile(ctx)
 	if err != nil {
@@ -472,6 +674,10 @@ func (b *b2LargeFile) finishLargeFile(ctx context.Context) (b2FileInterface, err
 	return &b2File{f}, nil
 }
 
+func (b *b2LargeFile) id() string {
+	return b.b.ID
+}
+
 func (b *b2LargeFile) getUploadPartURL(ctx context.Context) (b2FileChunkInterface, error) {
 	c, err := b.b.GetUploadPartURL(ctx)
 	if err != nil {
@@ -480,6 +686,10 @@ func (b *b2LargeFile) getUploadPartURL(ctx context.Context) (b2FileChunkInterfac
 	return &b2FileChunk{c}, nil
 }
 
+func (b *b2LargeFile) copyPart(ctx context.Context, srcID, rng string, index int) (int64, string, error) {
+	return b.b.CopyPart(ctx, srcID, rng, index)
+}
+
 func (b *b2LargeFile) cancel(ctx context.Context) error {
 	return b.b.CancelLargeFile(ctx)
 }
@@ -506,6 +716,8 @@ func (b *b2FileReader) stats() (int, string, string, map[string]string) {
 
 func (b *b2FileReader) id() string { return b.b.ID }
 
+func (b *b2FileReader) uploaded() time.Time { return b.b.UploadTimestamp }
+
 func (b *b2FileInfo) stats() (string, string, int64, string, map[string]string, string, time.Time) {
 	return b.b.Name, b.b.SHA1, b.b.Size, b.b.ContentType, b.b.Info, b.b.Status, b.b.Timestamp
 }
@@ -88,6 +88,16 @@ func (nb *nonBuffer) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// partStats returns the SHA1 and size of the data in buf.  Unlike Hash and Len,
+// these exclude the SHA1 that a nonBuffer appends, and so a nonBuffer must have
+// been read to the end.
+func partStats(buf writeBuffer) (string, int) {
+	if nb, ok := buf.(*nonBuffer); ok {
+		return fmt.Sprintf("%x", nb.hsh.Sum(nil)), nb.size
+	}
+	return buf.Hash(), buf.Len()
+}
+
 func (nb *nonBuffer) Reset() error {
 	nb.hsh.Reset()
 	nb.isEOF = false
@@ -97,9 +107,13 @@ func (nb *nonBuffer) Reset() error {
 
 type memoryBuffer struct {
 	buf *bytes.Buffer
-	hsh hash.Hash
+	hsh hash.Hash // nil if the buffer hashes lazily
+	sum string    // the lazily computed hash, if any
 	w   io.Writer
 	mux sync.Mutex
+
+	// account, if non-nil, is called with the change in buffered bytes.
+	account func(int64)
 }
 
 var bufpool *sync.Pool
@@ -118,10 +132,67 @@ func newMemoryBuffer() *memoryBuffer {
 	return mb
 }
 
-func (mb *memoryBuffer) Write(p []byte) (int, error)   { return mb.w.Write(p) }
+// newLazyMemoryBuffer returns a memory buffer that hashes its contents only
+// when Hash is called, for callers that usually know the hash already.
+func newLazyMemoryBuffer() *memoryBuffer {
+	mb := &memoryBuffer{}
+	mb.buf = bufpool.Get().(*bytes.Buffer)
+	mb.w = mb.buf
+	return mb
+}
+
 func (mb *memoryBuffer) Len() int                      { return mb.buf.Len() }
 func (mb *memoryBuffer) Reader() (readResetter, error) { return newResetter(mb.buf.Bytes()), nil }
-func (mb *memoryBuffer) Hash() string                  { return fmt.Sprintf("%x", mb.hsh.Sum(nil)) }
+
+func (mb *memoryBuffer) Hash() string {
+	if mb.hsh != nil {
+		return fmt.Sprintf("%x", mb.hsh.Sum(nil))
+	}
+	if mb.sum == "" {
+		mb.sum = fmt.Sprintf("%x", sha1.Sum(mb.buf.Bytes()))
+	}
+	return mb.sum
+}
+
+func (mb *memoryBuffer) Write(p []byte) (int, error) {
+	mb.sum = ""
+	n, err := mb.w.Write(p)
+	if mb.account != nil {
+		mb.account(int64(n))
+	}
+	return n, err
+}
+
+// fill reads up to n bytes from r straight into the buffer's spare capacity,
+// hashing and accounting for them as Write does, and returns them.  It returns
+// io.EOF if r ends first.
+func (mb *memoryBuffer) fill(r io.Reader, n int) ([]byte, error) {
+	mb.buf.Grow(n)
+	l := mb.buf.Len()
+	p := mb.buf.Bytes()[l : l+n]
+	k, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	p = p[:k]
+	mb.sum = ""
+	if mb.hsh != nil {
+		mb.hsh.Write(p)
+	}
+	// p is already in place; this only extends the buffer over it.
+	mb.buf.Write(p)
+	if mb.account != nil {
+		mb.account(int64(k))
+	}
+	return p, err
+}
+
+// grow ensures the buffer can hold n bytes without reallocating.
+func (mb *memoryBuffer) grow(n int) {
+	if n > mb.buf.Cap() {
+		mb.buf.Grow(n)
+	}
+}
 
 func (mb *memoryBuffer) Close() error {
 	mb.mux.Lock()
@@ -129,6 +200,9 @@ func (mb *memoryBuffer) Close() error {
 	if mb.buf == nil {
 		return nil
 	}
+	if mb.account != nil {
+		mb.account(-int64(mb.buf.Len()))
+	}
 	mb.buf.Truncate(0)
 	bufpool.Put(mb.buf)
 	mb.buf = nil
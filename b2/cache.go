@@ -0,0 +1,63 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewCachingWriter returns a writer for the named object that also keeps a
+// copy of the object in cacheDir, at the object's name (with "/" as the path
+// separator).  The copy is written to a temporary file in cacheDir and renamed
+// into place only once the upload to B2 succeeds, so readers of the cache
+// never see a partial file or one that B2 does not hold.  If the upload fails,
+// or the writer is cancelled, the temporary file is removed and the cache is
+// left as it was.  A writer that is neither closed nor cancelled leaves its
+// temporary file behind.
+func (b *Bucket) NewCachingWriter(ctx context.Context, name, cacheDir string) (*Writer, error) {
+	dst := filepath.Join(cacheDir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(cacheDir, dst)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("b2: %s: cannot be cached under %s", name, cacheDir)
+	}
+	tmp, err := ioutil.TempFile(cacheDir, ".blazer-cache-")
+	if err != nil {
+		return nil, err
+	}
+	w := b.Object(name).NewWriter(ctx)
+	w.Tee(tmp)
+	w.afterClose = func(err error) error {
+		cerr := tmp.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(dst), 0755)
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), dst)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+		return err
+	}
+	return w, nil
+}
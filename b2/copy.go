@@ -0,0 +1,368 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// An EncryptionMode is a kind of server-side encryption.
+type EncryptionMode string
+
+const (
+	// SSEB2 encrypts files with keys that B2 manages.
+	SSEB2 EncryptionMode = "SSE-B2"
+
+	// SSEC encrypts files with a key that the caller supplies, and must
+	// supply again to read the file.
+	SSEC EncryptionMode = "SSE-C"
+)
+
+// Encryption describes the server-side encryption of a file.
+type Encryption struct {
+	Mode EncryptionMode
+
+	// Key is the 256-bit AES key for SSEC.  It is ignored for SSEB2.
+	Key []byte
+}
+
+func (e *Encryption) validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Mode {
+	case SSEB2:
+		return nil
+	case SSEC:
+		if len(e.Key) != 32 {
+			return errors.New("b2: SSE-C requires a 32-byte key")
+		}
+		return nil
+	}
+	return errors.New("b2: unknown encryption mode " + string(e.Mode))
+}
+
+// copyRequest holds the parameters of a server-side copy.
+type copyRequest struct {
+	name        string
+	rng         string
+	bucketID    string
+	directive   string
+	contentType string
+	info        map[string]string
+	keepInfo    bool // replace only the content type
+	partSize    int64
+	concurrency int
+	dstEnc      *Encryption
+	srcEnc      *Encryption
+
+	progress func(name string, copied int)
+}
+
+// A CopyOption alters the behavior of Object.CopyTo.
+type CopyOption func(*copyRequest)
+
+// CopyEncryption encrypts the new object with the given settings, regardless
+// of the source object's encryption or the destination bucket's default.
+func CopyEncryption(e Encryption) CopyOption {
+	return func(r *copyRequest) {
+		r.dstEnc = &e
+	}
+}
+
+// CopySourceEncryption supplies the key of a source object that is encrypted
+// with SSEC.
+func CopySourceEncryption(e Encryption) CopyOption {
+	return func(r *copyRequest) {
+		r.srcEnc = &e
+	}
+}
+
+// CopyMetadata gives the new object the given content type and info, instead
+// of the source's.  If contentType is empty, B2 chooses one from the name's
+// extension.
+func CopyMetadata(contentType string, info map[string]string) CopyOption {
+	return func(r *copyRequest) {
+		r.directive = "REPLACE"
+		r.contentType = contentType
+		r.info = info
+		r.keepInfo = false
+	}
+}
+
+// CopyContentType gives the new object the given content type, but keeps the
+// source's info.  B2 can only replace both, so the source's info is fetched
+// first.
+func CopyContentType(contentType string) CopyOption {
+	return func(r *copyRequest) {
+		r.directive = "REPLACE"
+		r.contentType = contentType
+		r.keepInfo = true
+	}
+}
+
+// CopyPartSize sets the size of the parts in which CopyTo copies large
+// objects.  Objects larger than size are copied part by part, every part but
+// the last holding exactly size bytes, as the Writer's parts do.  The default
+// and maximum is 5GB, the most that B2 copies in one request; the minimum is
+// 5MB.
+func CopyPartSize(size int64) CopyOption {
+	return func(r *copyRequest) {
+		r.partSize = size
+	}
+}
+
+// CopyConcurrency sets how many parts of a large object CopyTo copies at once.
+// Values less than 1 are equivalent to 1, the default.
+func CopyConcurrency(n int) CopyOption {
+	return func(r *copyRequest) {
+		r.concurrency = n
+	}
+}
+
+// maxCopySize is the largest file that b2_copy_file will copy in one request.
+const maxCopySize = 5e9
+
+// CopyProgress reports the progress of Client.CopyBucketContents.  After each
+// object is copied, f is called with its name and the number of objects copied
+// so far.  Calls to f are not concurrent.  CopyProgress has no effect on
+// Object.CopyTo.
+func CopyProgress(f func(name string, copied int)) CopyOption {
+	return func(r *copyRequest) {
+		r.progress = f
+	}
+}
+
+// CopyTo makes a server-side copy of the object, named name, in dst, which
+// may be the object's own bucket.  The object's data never leaves B2.  The new
+// object keeps the source's content type and info, unless CopyMetadata or
+// CopyContentType is given.
+//
+// B2 copies at most 5GB in one request.  Larger objects, or any larger than
+// CopyPartSize, are copied as large files, part by part, and the copy's size
+// is checked against the source's.  Encryption options are not supported for
+// such copies.  If a large copy fails, the unfinished large file is
+// cancelled.
+func (o *Object) CopyTo(ctx context.Context, dst *Bucket, name string, opts ...CopyOption) (*Object, error) {
+	req := &copyRequest{
+		name:      name,
+		bucketID:  dst.b.id(),
+		directive: "COPY",
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	if err := req.dstEnc.validate(); err != nil {
+		return nil, err
+	}
+	if err := req.srcEnc.validate(); err != nil {
+		return nil, err
+	}
+	if err := o.ensure(ctx); err != nil {
+		return nil, err
+	}
+	if req.partSize <= 0 || req.partSize > maxCopySize {
+		req.partSize = maxCopySize
+	}
+	if req.directive == "REPLACE" && req.contentType == "" {
+		req.contentType = "b2/x-auto"
+	}
+	size := o.f.size()
+	large := size > req.partSize
+	if req.keepInfo || (large && req.directive == "COPY") {
+		// Large files take their metadata when they are started.
+		fi, err := o.f.getFileInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		_, _, _, ct, info, _, _ := fi.stats()
+		if req.directive == "COPY" {
+			req.contentType = ct
+		}
+		req.info = info
+	}
+	if large {
+		return o.copyLarge(ctx, dst, req, size)
+	}
+	f, err := o.f.copyFile(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		name: name,
+		f:    f,
+		b:    dst,
+	}, nil
+}
+
+// copyLarge copies the object, of the given size, with b2_copy_part.
+func (o *Object) copyLarge(ctx context.Context, dst *Bucket, req *copyRequest, size int64) (*Object, error) {
+	if req.dstEnc != nil || req.srcEnc != nil {
+		return nil, fmt.Errorf("b2: %s: encryption options are not supported when copying large files", o.name)
+	}
+	lf, err := dst.b.startLargeFile(ctx, req.name, req.contentType, req.info)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parts := int((size + req.partSize - 1) / req.partSize)
+	concurrency := req.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var cerr error
+	fail := func(err error) {
+		once.Do(func() {
+			cerr = err
+			cancel()
+		})
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ch {
+				start := int64(id-1) * req.partSize
+				end := start + req.partSize
+				if end > size {
+					end = size
+				}
+				n, _, err := lf.copyPart(ctx, o.f.id(), fmt.Sprintf("bytes=%d-%d", start, end-1), id)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				if n != end-start {
+					fail(fmt.Errorf("b2: %s: part %d: copied %d bytes, want %d", o.name, id, n, end-start))
+				}
+			}
+		}()
+	}
+dispatch:
+	for id := 1; id <= parts; id++ {
+		select {
+		case ch <- id:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if cerr == nil {
+		cerr = ctx.Err()
+	}
+	var f beFileInterface
+	if cerr == nil {
+		f, cerr = lf.finishLargeFile(ctx)
+	}
+	if cerr == nil && f.size() != size {
+		cerr = fmt.Errorf("b2: %s: copy has %d bytes, but the source has %d", o.name, f.size(), size)
+	}
+	if cerr != nil {
+		if f == nil {
+			cctx, ccancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer ccancel()
+			lf.cancel(cctx)
+		}
+		return nil, cerr
+	}
+	return &Object{
+		name: req.name,
+		f:    f,
+		b:    dst,
+	}, nil
+}
+
+// CopyBucketContents makes a server-side copy in dst of the latest version of
+// every object in src, under the same name and with the same content type and
+// info, for instance to move a bucket's contents to a bucket with different
+// settings.  Up to concurrency objects are copied at once.  The options are
+// applied to every copy.
+//
+// It returns the number of objects copied.  On the first error, copying stops
+// and the error is returned; objects already copied are left in place.
+func (c *Client) CopyBucketContents(ctx context.Context, src, dst *Bucket, concurrency int, opts ...CopyOption) (int, error) {
+	req := &copyRequest{}
+	for _, opt := range opts {
+		opt(req)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		copied int
+		err    error
+		wg     sync.WaitGroup
+	)
+	setErr := func(e error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			err = e
+			cancel()
+		}
+	}
+	ch := make(chan *Object)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range ch {
+				if _, e := obj.CopyTo(ctx, dst, obj.Name(), opts...); e != nil {
+					setErr(e)
+					continue
+				}
+				mu.Lock()
+				copied++
+				if req.progress != nil {
+					req.progress(obj.Name(), copied)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	iter := src.List(ctx, ListPrefetch())
+	for iter.Next() {
+		select {
+		case ch <- iter.Object():
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if err == nil && ctx.Err() == nil {
+		err = iter.Err()
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return copied, err
+}
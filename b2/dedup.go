@@ -0,0 +1,144 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"sync"
+)
+
+// A DedupIndex maps the SHA1 of an object's content to an object already
+// stored in B2 with that content.  When a Client has a DedupIndex, Writers
+// that would upload content the index already knows about instead perform a
+// server-side copy of the existing object, and so never send those bytes.
+//
+// Only files small enough to be sent in a single request are deduplicated;
+// the SHA1 of a large file is not known until every part has been uploaded.
+type DedupIndex interface {
+	// Lookup returns an object whose content has the given SHA1, or nil if
+	// there is no such object.
+	Lookup(ctx context.Context, sha1 string) (*Object, error)
+
+	// Add records that the given object has content with the given SHA1.
+	Add(ctx context.Context, sha1 string, o *Object) error
+
+	// Remove forgets an object that Lookup returned for the given SHA1, but
+	// that no longer exists.  It should leave the entry alone if it now
+	// refers to a different object.
+	Remove(ctx context.Context, sha1 string, o *Object) error
+}
+
+// Dedup returns a ClientOption that deduplicates uploads against the given
+// index.
+func Dedup(idx DedupIndex) ClientOption {
+	return func(c *clientOptions) {
+		c.dedup = idx
+	}
+}
+
+// NewDedupCache returns a DedupIndex that is kept in memory.  It remembers
+// every object written through the Client for as long as the process runs.
+func NewDedupCache() DedupIndex {
+	return &dedupCache{m: make(map[string]*Object)}
+}
+
+type dedupCache struct {
+	mu sync.Mutex
+	m  map[string]*Object
+}
+
+func (d *dedupCache) Lookup(_ context.Context, sha1 string) (*Object, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.m[sha1], nil
+}
+
+func (d *dedupCache) Add(_ context.Context, sha1 string, o *Object) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.m[sha1] = o
+	return nil
+}
+
+func (d *dedupCache) Remove(_ context.Context, sha1 string, o *Object) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.m[sha1] == o {
+		delete(d.m, sha1)
+	}
+	return nil
+}
+
+// dedupCopy looks sha1 up in the client's index and, if an object with that
+// content exists, copies it to the writer's destination.  It reports whether
+// the copy was made.
+func (w *Writer) dedupCopy(sha1, ctype string) (bool, error) {
+	idx := w.o.b.c.opts.dedup
+	if idx == nil || len(sha1) != 40 {
+		return false, nil
+	}
+	src, err := idx.Lookup(w.ctx, sha1)
+	if err != nil {
+		return false, err
+	}
+	if src == nil {
+		return false, nil
+	}
+	if err := src.ensure(w.ctx); err != nil {
+		if IsNotExist(err) {
+			w.dedupRemove(sha1, src)
+			return false, nil
+		}
+		return false, err
+	}
+	f, err := src.f.copyFile(w.ctx, &copyRequest{
+		name:        w.name,
+		bucketID:    w.o.b.b.id(),
+		directive:   "REPLACE",
+		contentType: ctype,
+		info:        w.info,
+	})
+	if err != nil {
+		if IsNotExist(err) {
+			// The version the index named has been deleted since.
+			w.dedupRemove(sha1, src)
+			return false, nil
+		}
+		return false, err
+	}
+	w.v(2).Infof("b2 writer: %s: copied from %s (sha1 %s)", w.name, src.name, sha1)
+	w.o.f = f
+	return true, nil
+}
+
+// dedupAdd records a newly uploaded object in the client's index.
+func (w *Writer) dedupAdd(sha1 string) {
+	idx := w.o.b.c.opts.dedup
+	if idx == nil || len(sha1) != 40 {
+		return
+	}
+	if err := idx.Add(w.ctx, sha1, w.o); err != nil {
+		w.v(1).Infof("b2 writer: %s: could not add to dedup index: %v", w.name, err)
+	}
+}
+
+// dedupRemove drops a stale entry from the client's index, so that the
+// content is uploaded as normal.
+func (w *Writer) dedupRemove(sha1 string, src *Object) {
+	w.v(2).Infof("b2 writer: %s: dedup source %s no longer exists", w.name, src.name)
+	if err := w.o.b.c.opts.dedup.Remove(w.ctx, sha1, src); err != nil {
+		w.v(1).Infof("b2 writer: %s: could not remove from dedup index: %v", w.name, err)
+	}
+}
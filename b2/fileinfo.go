@@ -0,0 +1,136 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FileInfoByID returns the object version with the given file ID, in
+// whichever bucket holds it.  The object's attributes are fetched along with
+// it, so a following call to Attrs makes no request.
+func (c *Client) FileInfoByID(ctx context.Context, id string) (*Object, error) {
+	return c.fileInfoByID(ctx, id, &bucketCache{c: c})
+}
+
+// FileInfo returns the object version in b with the given file ID, as
+// FileInfoByID does.  If the ID names a file in another bucket, the returned
+// error satisfies IsNotExist.
+func (b *Bucket) FileInfo(ctx context.Context, fileID string) (*Object, error) {
+	f, bucketID, err := b.c.backend.fileByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if bucketID != b.b.id() {
+		return nil, b2err{
+			err:         fmt.Errorf("b2: file ID %s is not in bucket %s", fileID, b.Name()),
+			notFoundErr: true,
+		}
+	}
+	return &Object{
+		name: f.name(),
+		f:    f,
+		b:    b,
+	}, nil
+}
+
+// FileInfoBatch is like FileInfoByID for many IDs, fetching up to concurrency
+// of them at a time.  The returned objects and errors are aligned with ids: for
+// each i, either objs[i] is the object with ID ids[i], or errs[i] says why it
+// could not be fetched.  If ctx is cancelled, no more requests are made, and
+// the remaining IDs get the context's error.  Values of concurrency less than
+// 1 are equivalent to 1.
+func (c *Client) FileInfoBatch(ctx context.Context, ids []string, concurrency int) ([]*Object, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	objs := make([]*Object, len(ids))
+	errs := make([]error, len(ids))
+	bc := &bucketCache{c: c}
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				objs[i], errs[i] = c.fileInfoByID(ctx, ids[i], bc)
+			}
+		}()
+	}
+	i := 0
+dispatch:
+	for ; i < len(ids); i++ {
+		select {
+		case ch <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(ch)
+	wg.Wait()
+	for ; i < len(ids); i++ {
+		errs[i] = ctx.Err()
+	}
+	return objs, errs
+}
+
+func (c *Client) fileInfoByID(ctx context.Context, id string, bc *bucketCache) (*Object, error) {
+	f, bucketID, err := c.backend.fileByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := bc.get(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		name: f.name(),
+		f:    f,
+		b:    b,
+	}, nil
+}
+
+// bucketCache finds buckets by ID, listing the account's buckets at most
+// once.
+type bucketCache struct {
+	c      *Client
+	mu     sync.Mutex
+	listed bool
+	m      map[string]*Bucket
+}
+
+func (bc *bucketCache) get(ctx context.Context, id string) (*Bucket, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if !bc.listed {
+		bs, err := bc.c.ListBuckets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		bc.m = make(map[string]*Bucket)
+		for _, b := range bs {
+			bc.m[b.b.id()] = b
+		}
+		bc.listed = true
+	}
+	b, ok := bc.m[id]
+	if !ok {
+		return nil, fmt.Errorf("b2: file's bucket %q is not visible to this client", id)
+	}
+	return b, nil
+}
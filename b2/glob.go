@@ -0,0 +1,61 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// Glob returns the objects whose names match pattern, in the syntax of
+// path.Match, in name order.  If limit is positive, at most limit objects are
+// returned.  Options are applied to the listing as they are for List, except
+// that ListPrefix is replaced.
+//
+// Only the part of pattern before its first special character is sent to B2,
+// as a prefix; the rest is matched client-side.  Every object under that
+// prefix is listed, and so counts against the bucket's transactions, even if
+// few match.  Patterns that begin with a literal directory, such as
+// "logs/2024-*/app-*.log", are therefore much cheaper than those that do not,
+// such as "*/app.log".
+func (b *Bucket) Glob(ctx context.Context, pattern string, limit int, opts ...ListOption) ([]*Object, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	opts = append(opts, ListPrefix(globPrefix(pattern)))
+	var objs []*Object
+	iter := b.List(ctx, opts...)
+	for iter.Next() {
+		obj := iter.Object()
+		if ok, _ := path.Match(pattern, obj.Name()); !ok {
+			continue
+		}
+		objs = append(objs, obj)
+		if limit > 0 && len(objs) >= limit {
+			return objs, nil
+		}
+	}
+	return objs, iter.Err()
+}
+
+// globPrefix returns the literal part of pattern before its first special
+// character.
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
@@ -16,12 +16,18 @@ package b2
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
 	"sync"
 )
 
 // List returns an iterator for selecting objects in a bucket.  The default
 // behavior, with no options, is to list all currently un-hidden objects.
+//
+// B2 lists objects in lexicographic order of their UTF-8 names.  When listing
+// with ListPrefix, the iterator relies on this to stop as soon as it sees a
+// name past the prefix, rather than requesting further pages.
 func (b *Bucket) List(ctx context.Context, opts ...ListOption) *ObjectIterator {
 	o := &ObjectIterator{
 		bucket: b,
@@ -56,16 +62,38 @@ type ObjectIterator struct {
 	init   sync.Once
 	l      lister
 	count  int
+
+	prefixes []string
+	next     chan listing // the page being prefetched, if any
 }
 
 type lister func(context.Context, int, *cursor) ([]*Object, *cursor, error)
 
-func (o *ObjectIterator) page(ctx context.Context) error {
+// listing is the result of one call to a lister.
+type listing struct {
+	objs []*Object
+	c    *cursor
+	err  error
+}
+
+func (o *ObjectIterator) fetch(ctx context.Context, c *cursor) listing {
 	if o.opts.locker != nil {
 		o.opts.locker.Lock()
 		defer o.opts.locker.Unlock()
 	}
-	objs, c, err := o.l(ctx, o.count, o.c)
+	objs, c, err := o.l(ctx, o.count, c)
+	return listing{objs: objs, c: c, err: err}
+}
+
+func (o *ObjectIterator) page(ctx context.Context) error {
+	var l listing
+	if o.next != nil {
+		l = <-o.next
+		o.next = nil
+	} else {
+		l = o.fetch(ctx, o.c)
+	}
+	objs, c, err := l.objs, l.c, l.err
 	if err != nil && err != io.EOF {
 		if bNotExist.MatchString(err.Error()) {
 			return b2err{
@@ -81,9 +109,54 @@ func (o *ObjectIterator) page(ctx context.Context) error {
 	if err == io.EOF {
 		o.final = true
 	}
+	if o.opts.prefix != "" {
+		var past bool
+		o.objs, past = inPrefix(o.objs, o.opts.prefix)
+		if past {
+			o.final = true
+		}
+	}
+	for _, obj := range o.objs {
+		if obj.f.status() == "folder" {
+			o.prefixes = append(o.prefixes, obj.name)
+		}
+	}
+	if o.opts.prefetch && !o.final {
+		o.next = make(chan listing, 1)
+		go func(next chan listing, c *cursor) { next <- o.fetch(ctx, c) }(o.next, o.c)
+	}
 	return nil
 }
 
+// Prefixes returns the common prefixes, or "subdirectories", that the
+// iterator has found so far when listing with ListDelimiter, in the order they
+// were listed.  Each prefix is also returned, as an object whose status is
+// Folder, by Object.  Once Next has returned false, Prefixes holds every
+// prefix at the listed level.
+func (o *ObjectIterator) Prefixes() []string {
+	p := make([]string, len(o.prefixes))
+	copy(p, o.prefixes)
+	return p
+}
+
+// inPrefix returns the objects, which must be in lexicographic order, whose
+// names begin with pfx.  It reports whether any name sorted after every name
+// with the prefix, in which case no later page can hold a match.
+func inPrefix(objs []*Object, pfx string) ([]*Object, bool) {
+	var keep []*Object
+	for _, obj := range objs {
+		name := obj.Name()
+		if strings.HasPrefix(name, pfx) {
+			keep = append(keep, obj)
+			continue
+		}
+		if name > pfx {
+			return keep, true
+		}
+	}
+	return keep, false
+}
+
 // Next advances the iterator to the next object.  It should be called before
 // any calls to Object().  If Next returns true, then the next call to Object()
 // will be valid.  Once Next returns false, it is important to check the return
@@ -100,6 +173,9 @@ func (o *ObjectIterator) Next() bool {
 			if o.count > 100 {
 				o.count = 100
 			}
+			if o.opts.partsConc > 0 {
+				o.l = withUploadedParts(o.l, o.opts.partsConc)
+			}
 		case o.opts.hidden:
 			o.l = o.bucket.listObjects
 		default:
@@ -153,6 +229,8 @@ type objectIteratorOptions struct {
 	delimiter  string
 	pageSize   int
 	locker     sync.Locker
+	prefetch   bool
+	partsConc  int
 }
 
 // A ListOption alters the default behavor of List.
@@ -173,6 +251,20 @@ func ListUnfinished() ListOption {
 	}
 }
 
+// ListUploadedParts, with ListUnfinished, also lists the parts each
+// unfinished large file holds, so that Object.UploadedParts can report them.
+// This costs at least one more request per file; up to concurrency files are
+// looked up at a time, as each page is listed.  Values of concurrency less
+// than 1 are equivalent to 1.
+func ListUploadedParts(concurrency int) ListOption {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return func(o *objectIteratorOptions) {
+		o.partsConc = concurrency
+	}
+}
+
 // ListPrefix will restrict the output to objects whose names begin with
 // prefix.
 func ListPrefix(pfx string) ListOption {
@@ -208,6 +300,17 @@ func ListPageSize(count int) ListOption {
 	}
 }
 
+// ListPrefetch causes the iterator to request each page of results while the
+// caller is still working through the one before, so that a caller that
+// hands objects off to concurrent workers is not left waiting on B2 at every
+// page boundary.  An iterator that is abandoned part way through may have
+// made one request more than it needed.
+func ListPrefetch() ListOption {
+	return func(o *objectIteratorOptions) {
+		o.prefetch = true
+	}
+}
+
 // ListLocker passes the iterator a lock which will be held during network
 // round-trips.
 func ListLocker(l sync.Locker) ListOption {
@@ -329,3 +432,54 @@ func (b *Bucket) listUnfinishedLargeFiles(ctx context.Context, count int, c *cur
 	}
 	return objects, next, rtnErr
 }
+
+// UploadedParts summarizes the parts of an unfinished large file that B2
+// holds.
+type UploadedParts struct {
+	Count int   // the number of parts
+	Size  int64 // their total size
+}
+
+// UploadedParts returns the parts uploaded so far to an unfinished large file
+// from a listing with ListUploadedParts, or nil for any other object.
+func (o *Object) UploadedParts() *UploadedParts {
+	return o.parts
+}
+
+// withUploadedParts returns a lister that fills in the parts of each object
+// that l lists, looking up to concurrency of them up at a time.
+func withUploadedParts(l lister, concurrency int) lister {
+	return func(ctx context.Context, count int, c *cursor) ([]*Object, *cursor, error) {
+		objs, next, err := l(ctx, count, c)
+		if err != nil && err != io.EOF {
+			return objs, next, err
+		}
+		ch := make(chan *Object)
+		errs := make(chan error, len(objs))
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for obj := range ch {
+					seen, _, size, err := listSeenParts(ctx, obj.f)
+					if err != nil {
+						errs <- fmt.Errorf("b2: %s: listing parts: %v", obj.name, err)
+						continue
+					}
+					obj.parts = &UploadedParts{Count: len(seen), Size: size}
+				}
+			}()
+		}
+		for _, obj := range objs {
+			ch <- obj
+		}
+		close(ch)
+		wg.Wait()
+		close(errs)
+		if perr := <-errs; perr != nil {
+			return nil, nil, perr
+		}
+		return objs, next, err
+	}
+}
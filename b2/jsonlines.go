@@ -0,0 +1,70 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// A JSONLinesWriter writes newline-delimited JSON to a B2 object.  It is safe
+// for concurrent use; each value is written as a single, whole line.
+type JSONLinesWriter struct {
+	mu  sync.Mutex
+	w   *Writer
+	enc *json.Encoder
+}
+
+// NewJSONLinesWriter returns a JSONLinesWriter for the named object.  Unless
+// the given options say otherwise, the object's content type is
+// "application/x-ndjson".
+//
+// Callers must close the writer when finished and check the error status.
+func (b *Bucket) NewJSONLinesWriter(ctx context.Context, name string, opts ...WriterOption) (*JSONLinesWriter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w := b.Object(name).NewWriter(ctx, opts...)
+	if w.contentType == "" {
+		w.contentType = "application/x-ndjson"
+	}
+	return &JSONLinesWriter{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}, nil
+}
+
+// Encode writes the JSON encoding of v, followed by a newline.
+func (j *JSONLinesWriter) Encode(v interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.w.ctx.Err(); err != nil {
+		return err
+	}
+	return j.enc.Encode(v)
+}
+
+// Close finishes the object.  It must be called, and its error checked.
+func (j *JSONLinesWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.w.Close()
+}
+
+// Writer returns the underlying Writer, e.g. to check its status.
+func (j *JSONLinesWriter) Writer() *Writer {
+	return j.w
+}
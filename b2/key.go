@@ -139,6 +139,12 @@ func (c *Client) ListKeys(ctx context.Context, count int, cursor string) ([]*Key
 	return keys, next, rerr
 }
 
+// DeleteKey removes the application key with the given ID from B2.  It is
+// like Key.Delete, for keys known only by ID.
+func (c *Client) DeleteKey(ctx context.Context, id string) error {
+	return c.backend.deleteKey(ctx, id)
+}
+
 // CreateKey creates a scoped application key that is valid only for this bucket.
 func (b *Bucket) CreateKey(ctx context.Context, name string, opts ...KeyOption) (*Key, error) {
 	var ko keyOptions
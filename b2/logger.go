@@ -0,0 +1,59 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"log"
+
+	"github.com/kurin/blazer/internal/blog"
+)
+
+// A Logger receives a client's log messages.  Informational messages are
+// given a verbosity: V(level) returns a logger for messages at that level,
+// and should discard them if the level is not enabled.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	V(level int) InfoLogger
+}
+
+// An InfoLogger logs informational messages.
+type InfoLogger interface {
+	Infof(format string, args ...interface{})
+}
+
+// WithLogger returns a ClientOption that sends the messages of the client's
+// writers to l.  By default, they go to the standard log package, with
+// verbosity controlled by the B2_LOG_LEVEL environment variable.
+func WithLogger(l Logger) ClientOption {
+	return func(c *clientOptions) {
+		c.logger = l
+	}
+}
+
+// stdLogger is the default Logger.
+type stdLogger struct{}
+
+func (stdLogger) Infof(format string, args ...interface{})  { log.Printf(format, args...) }
+func (stdLogger) Errorf(format string, args ...interface{}) { log.Printf(format, args...) }
+func (stdLogger) V(level int) InfoLogger                    { return blog.V(int32(level)) }
+
+// logger returns the writer's client's Logger.
+func (w *Writer) logger() Logger {
+	if w.o != nil && w.o.b != nil && w.o.b.c != nil && w.o.b.c.opts.logger != nil {
+		return w.o.b.c.opts.logger
+	}
+	return stdLogger{}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// manifestSuffix is appended to an object's name to name its manifest.
+const manifestSuffix = ".manifest.json"
+
+// manifest is the JSON document that WriteManifest uploads.
+type manifest struct {
+	Name   string         `json:"name"`
+	FileID string         `json:"fileId"`
+	Size   int64          `json:"size"`
+	Parts  []manifestPart `json:"parts"`
+}
+
+type manifestPart struct {
+	Number int    `json:"number"`
+	Size   int    `json:"size"`
+	SHA1   string `json:"sha1"`
+}
+
+// IsManifestError reports whether err is the failure to upload the manifest
+// of a large file that was otherwise written successfully.
+func IsManifestError(err error) bool {
+	e, ok := err.(b2err)
+	if !ok {
+		return false
+	}
+	return e.manifestErr
+}
+
+// writeManifest uploads the manifest of the writer's finished large file.
+func (w *Writer) writeManifest() error {
+	m := manifest{
+		Name:   w.name,
+		FileID: w.o.f.id(),
+	}
+	w.hmux.Lock()
+	for id, sha := range w.sent {
+		m.Parts = append(m.Parts, manifestPart{Number: id, Size: w.sizes[id], SHA1: sha})
+		m.Size += int64(w.sizes[id])
+	}
+	w.hmux.Unlock()
+	sort.Slice(m.Parts, func(i, j int) bool { return m.Parts[i].Number < m.Parts[j].Number })
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	mw := w.o.b.Object(w.name+manifestSuffix).NewWriter(w.ctx, WithAttrsOption(&Attrs{ContentType: "application/json"}))
+	if _, err := mw.Write(b); err != nil {
+		mw.Close()
+		return b2err{err: fmt.Errorf("%s: manifest: %v", w.name, err), manifestErr: true}
+	}
+	if err := mw.Close(); err != nil {
+		return b2err{err: fmt.Errorf("%s: manifest: %v", w.name, err), manifestErr: true}
+	}
+	return nil
+}
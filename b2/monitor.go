@@ -107,6 +107,92 @@ type ReaderStatus struct {
 	Progress []float64
 }
 
+// TransactionStats reports the number of B2 API calls made by a client,
+// grouped by the transaction class Backblaze uses for billing.  Calls are
+// counted whenever B2 returns a response, regardless of its status.
+type TransactionStats struct {
+	// ClassA counts uploads, deletions, and other free transactions, such as
+	// b2_upload_file, b2_upload_part, b2_hide_file, b2_delete_file_version,
+	// b2_delete_bucket, and b2_delete_key.
+	ClassA int64
+
+	// ClassB counts downloads and b2_get_file_info.
+	ClassB int64
+
+	// ClassC counts listings, copies, authorization, and the creation and
+	// update of buckets and keys.
+	ClassC int64
+
+	// Unclassified counts calls that blazer doesn't know how to classify.
+	Unclassified int64
+}
+
+var transactionClasses = map[string]byte{
+	"b2_cancel_large_file":           'A',
+	"b2_delete_bucket":               'A',
+	"b2_delete_file_version":         'A',
+	"b2_delete_key":                  'A',
+	"b2_finish_large_file":           'A',
+	"b2_get_upload_part_url":         'A',
+	"b2_get_upload_url":              'A',
+	"b2_hide_file":                   'A',
+	"b2_start_large_file":            'A',
+	"b2_upload_file":                 'A',
+	"b2_upload_part":                 'A',
+	"b2_download_file_by_id":         'B',
+	"b2_download_file_by_name":       'B',
+	"b2_get_file_info":               'B',
+	"b2_authorize_account":           'C',
+	"b2_copy_file":                   'C',
+	"b2_copy_part":                   'C',
+	"b2_create_bucket":               'C',
+	"b2_create_key":                  'C',
+	"b2_get_download_authorization":  'C',
+	"b2_list_buckets":                'C',
+	"b2_list_file_names":             'C',
+	"b2_list_file_versions":          'C',
+	"b2_list_keys":                   'C',
+	"b2_list_parts":                  'C',
+	"b2_list_unfinished_large_files": 'C',
+	"b2_update_bucket":               'C',
+}
+
+func (ts *TransactionStats) record(method string) {
+	switch transactionClasses[method] {
+	case 'A':
+		ts.ClassA++
+	case 'B':
+		ts.ClassB++
+	case 'C':
+		ts.ClassC++
+	default:
+		ts.Unclassified++
+	}
+}
+
+// TransactionStats returns the number of transactions, by class, that this
+// client has made since it was created.
+func (c *Client) TransactionStats() TransactionStats {
+	c.slock.Lock()
+	defer c.slock.Unlock()
+	return c.txStats
+}
+
+func (c *Client) accountMemory(n int64) {
+	c.slock.Lock()
+	defer c.slock.Unlock()
+	c.mem += n
+}
+
+// MemoryInUse returns the total number of bytes buffered in memory by all of
+// this client's Writers.  This can be used to implement admission control, by
+// declining to start new uploads while too much memory is in use.
+func (c *Client) MemoryInUse() int64 {
+	c.slock.Lock()
+	defer c.slock.Unlock()
+	return c.mem
+}
+
 // Status returns information about the current state of the client.
 func (c *Client) Status() *StatusInfo {
 	c.slock.Lock()
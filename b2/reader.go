@@ -22,7 +22,9 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kurin/blazer/internal/blog"
@@ -30,6 +32,24 @@ import (
 
 var errNoMoreContent = errors.New("416: out of content")
 
+// A RangeNotSatisfiableError is returned by Reader.Read when the reader starts
+// past the end of the object.  Size is the object's size when the error was
+// detected, which may differ from a size learned earlier if the object has
+// since been replaced.
+type RangeNotSatisfiableError struct {
+	Name   string
+	Offset int64
+	Size   int64
+}
+
+func (e *RangeNotSatisfiableError) Error() string {
+	return fmt.Sprintf("b2: %s: range starting at %d not satisfiable: object has %d bytes", e.Name, e.Offset, e.Size)
+}
+
+// ErrMaxBytes is returned by Reader.Read when the object is larger than the
+// reader's MaxBytes.
+var ErrMaxBytes = errors.New("b2: object exceeds Reader.MaxBytes")
+
 // Reader reads files from B2.
 type Reader struct {
 	// ConcurrentDownloads is the number of simultaneous downloads to pull from
@@ -42,14 +62,49 @@ type Reader struct {
 	// 10MB.
 	ChunkSize int
 
+	// MaxBytes, if positive, is the most the reader will read.  If the object
+	// (or range) is larger, Read returns the first MaxBytes bytes and then
+	// ErrMaxBytes.  The reader downloads at most one byte past the limit.
+	MaxBytes int64
+
+	// VerifyProgressFunc, if set, is called as the download is checksummed,
+	// with the number of bytes hashed so far.  The hash is computed as Read
+	// returns data, in order, even when chunks arrive out of order, so that
+	// Verify has no work left at the end.  It is called from Read each time a
+	// chunk has been hashed in full, and so never concurrently.
+	VerifyProgressFunc func(hashed int64)
+
+	// ProgressFunc, if set, is called from Read as data is returned to the
+	// caller, with the number of bytes read so far and the total the reader
+	// will read, which is the object's size, less the offset, limited by the
+	// range and MaxBytes.  The total is found from the object's attributes,
+	// at the cost of one extra request; if that fails, it is -1.  To keep the
+	// cost down on fast links, calls are made at most every megabyte or tenth
+	// of a second, and once more at the end of the object.
+	ProgressFunc func(downloaded, total int64)
+
+	// VerifySHA1, if true, checks the downloaded bytes against the SHA1 B2
+	// holds for the object when the end of the object is reached.  On a
+	// mismatch, the final Read returns an error in place of io.EOF, as does
+	// Close.  Large files have no SHA1 of their own; for those, the
+	// large_file_sha1 in the file info is used if it was set on upload.  If
+	// there is nothing to check against, or only part of the object was
+	// read, the check is skipped, and VerifySkipped reports it.
+	VerifySHA1 bool
+
+	parent     context.Context // the context given to NewReader
 	ctx        context.Context
 	cancel     context.CancelFunc // cancels ctx
+	id         string             // the file to download by ID, if any; name is also the ID
 	o          *Object
 	name       string
 	offset     int64 // the start of the file
 	length     int64 // the length to read, or -1
+	end        int64 // the end of the reader's range, or -1
+	size       int64 // the object's size, or -1 until Seek needs it
 	csize      int   // chunk size
 	read       int   // amount read
+	vread      int   // amount reported to VerifyProgressFunc
 	chwid      int   // chunks written
 	chrid      int   // chunks read
 	chbuf      chan *rchunk
@@ -58,6 +113,14 @@ type Reader struct {
 	vrfy       hash.Hash
 	readOffEnd bool
 	sha1       string
+	vskipped   bool  // VerifySHA1 had nothing to check
+	verr       error // VerifySHA1 found a mismatch
+
+	// ProgressFunc reporting
+	pread   int       // amount reported
+	ptime   time.Time // time of the last report
+	ptotal  int64
+	pcalled bool
 
 	rmux  sync.Mutex // guards rcond
 	rcond *sync.Cond
@@ -67,6 +130,10 @@ type Reader struct {
 
 	smux sync.Mutex
 	smap map[int]*meteredReader
+
+	wg      sync.WaitGroup // download threads
+	reading int32          // set while Read is running
+	pool    []*rchunk      // buffers kept by Reset
 }
 
 type rchunk struct {
@@ -78,9 +145,163 @@ type rchunk struct {
 func (r *Reader) Close() error {
 	r.cancel()
 	r.o.b.c.removeReader(r)
+	return r.verr
+}
+
+// VerifySkipped reports whether VerifySHA1 was set but the reader could not
+// check the download, because B2 had no SHA1 for the object or because the
+// whole object was not read.  It is meaningful once Read has returned io.EOF.
+func (r *Reader) VerifySkipped() bool {
+	return r.vskipped
+}
+
+// Reset prepares the reader to read the whole of the named object, in the
+// same bucket, from the beginning.  It stops any downloads in progress,
+// closing their response bodies, and keeps the reader's chunk buffers for
+// reuse.  ConcurrentDownloads and ChunkSize are kept; all other state,
+// including any error, is discarded.  The reader uses the context it was
+// created with.
+//
+// Reset must not be called concurrently with Read; if a Read is in progress,
+// Reset returns an error and leaves the reader unchanged.
+func (r *Reader) Reset(name string) error {
+	if atomic.LoadInt32(&r.reading) > 0 {
+		return errors.New("b2: Reset called during Read")
+	}
+	r.stop()
+	r.o = r.o.b.Object(name)
+	r.name = name
+	r.id = ""
+	r.offset = 0
+	r.length = -1
+	r.end = -1
+	r.size = -1
+	r.clear()
 	return nil
 }
 
+// Seek sets the offset of the next Read, satisfying io.Seeker.  Offsets are
+// positions in the object, even for a reader made with NewRangeReader, and
+// io.SeekEnd is relative to the object's size, which is fetched from its
+// attributes on first use.  Seeking stops any downloads in progress, as Reset
+// does; the next Read starts afresh at the new offset, and reads to the end
+// of the reader's range, if it has one.  Seeking beyond the end of the
+// object is allowed, but a Read there returns a RangeNotSatisfiableError.
+// ConcurrentDownloads and ChunkSize are kept.  Seeking resets the count of
+// bytes read, so MaxBytes and ProgressFunc start again from the new offset,
+// and Verify can succeed only for a reader that seeks back to the start of
+// the object.
+//
+// Like Reset, Seek must not be called concurrently with Read.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if atomic.LoadInt32(&r.reading) > 0 {
+		return 0, errors.New("b2: Seek called during Read")
+	}
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.offset + int64(r.read) + offset
+	case io.SeekEnd:
+		if r.size < 0 {
+			attrs, err := r.o.Attrs(r.ctx)
+			if err != nil {
+				return 0, err
+			}
+			r.size = attrs.Size
+		}
+		pos = r.size + offset
+	default:
+		return 0, fmt.Errorf("b2: Seek: invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("b2: Seek: negative offset %d", pos)
+	}
+	r.stop()
+	r.offset = pos
+	r.length = -1
+	r.clear()
+	if r.end >= 0 {
+		r.length = r.end - pos
+		if r.length <= 0 {
+			// Past the end of the range; there is nothing to read.
+			r.setErrNoCancel(io.EOF)
+		}
+	}
+	return pos, nil
+}
+
+// stop halts any downloads in progress, keeping the reader's chunk buffers
+// for reuse, and gives the reader a new context.
+func (r *Reader) stop() {
+	r.cancel()
+	r.wg.Wait()
+	if r.rcond != nil {
+		// Wake any Read left waiting on a chunk.
+		r.rmux.Lock()
+		r.rcond.Broadcast()
+		r.rmux.Unlock()
+	}
+	r.o.b.c.removeReader(r)
+
+	seen := make(map[*rchunk]bool)
+	for _, buf := range r.pool {
+		seen[buf] = true
+	}
+	keep := func(buf *rchunk) {
+		if buf == nil || seen[buf] {
+			return
+		}
+		seen[buf] = true
+		buf.Reset()
+		buf.final = false
+		r.pool = append(r.pool, buf)
+	}
+	for _, buf := range r.chunks {
+		keep(buf)
+	}
+	if r.chbuf != nil {
+	drain:
+		for {
+			select {
+			case buf, ok := <-r.chbuf:
+				if !ok {
+					break drain
+				}
+				keep(buf)
+			default:
+				break drain
+			}
+		}
+	}
+	r.ctx, r.cancel = context.WithCancel(r.parent)
+}
+
+// clear discards the state of the reader's last download.
+func (r *Reader) clear() {
+	r.read = 0
+	r.vread = 0
+	r.pread = 0
+	r.ptime = time.Time{}
+	r.pcalled = false
+	r.chbuf = nil
+	r.init = sync.Once{}
+	r.vrfy = nil
+	r.vskipped = false
+	r.verr = nil
+	r.rmux.Lock()
+	r.chwid = 0
+	r.chrid = 0
+	r.chunks = make(map[int]*rchunk)
+	r.readOffEnd = false
+	r.sha1 = ""
+	r.rmux.Unlock()
+	r.emux.Lock()
+	r.err = nil
+	r.emux.Unlock()
+}
+
 func (r *Reader) setErr(err error) {
 	r.emux.Lock()
 	defer r.emux.Unlock()
@@ -105,7 +326,9 @@ func (r *Reader) getErr() error {
 }
 
 func (r *Reader) thread() {
+	r.wg.Add(1)
 	go func() {
+		defer r.wg.Done()
 		for {
 			var buf *rchunk
 			select {
@@ -117,27 +340,47 @@ func (r *Reader) thread() {
 			case <-r.ctx.Done():
 				return
 			}
+			size := int64(r.csize)
 			r.rmux.Lock()
 			chunkID := r.chwid
 			r.chwid++
-			r.rmux.Unlock()
-			offset := int64(chunkID*r.csize) + r.offset
-			size := int64(r.csize)
 			if r.length > 0 {
-				if size > r.length {
+				if size >= r.length {
 					buf.final = true
 					size = r.length
 				}
 				r.length -= size
 			}
+			r.rmux.Unlock()
+			offset := int64(chunkID*r.csize) + r.offset
 			var b backoff
+			var rechecked bool
 		redo:
-			fr, err := r.o.b.b.downloadFileByName(r.ctx, r.name, offset, size, false)
+			fr, err := r.download(r.ctx, offset, size, false)
+			if err == errNoMoreContent && chunkID == 0 && r.offset > 0 && !rechecked {
+				// The reader's first byte is past the end, perhaps because the
+				// object changed since its size was learned.
+				rechecked = true
+				cur, err := r.currentSize()
+				if err == nil && r.offset > cur {
+					err = &RangeNotSatisfiableError{Name: r.name, Offset: r.offset, Size: cur}
+				}
+				if err != nil {
+					r.setErr(err)
+					r.rcond.Broadcast()
+					return
+				}
+				if r.offset < cur {
+					// The object has grown; the range is good now.
+					goto redo
+				}
+				// The reader starts exactly at the end: there is nothing to read.
+			}
 			if err == errNoMoreContent {
 				// this read generated a 416 so we are entirely past the end of the object
-				r.readOffEnd = true
 				buf.final = true
 				r.rmux.Lock()
+				r.readOffEnd = true
 				r.chunks[chunkID] = buf
 				r.rmux.Unlock()
 				r.rcond.Broadcast()
@@ -148,9 +391,15 @@ func (r *Reader) thread() {
 				r.rcond.Broadcast()
 				return
 			}
-			rsize, _, sha1, _ := fr.stats()
-			if len(sha1) == 40 && r.sha1 != sha1 {
+			rsize, _, sha1, info := fr.stats()
+			if len(sha1) != 40 {
+				// Large files have no SHA1, but may have one in their info.
+				sha1 = info["large_file_sha1"]
+			}
+			if len(sha1) == 40 {
+				r.rmux.Lock()
 				r.sha1 = sha1
+				r.rmux.Unlock()
 			}
 			mr := &meteredReader{r: noopResetter{fr}, size: int(rsize)}
 			r.smux.Lock()
@@ -164,7 +413,7 @@ func (r *Reader) thread() {
 			if i < int64(rsize) || err == io.ErrUnexpectedEOF {
 				// Probably the network connection was closed early.  Retry.
 				blog.V(1).Infof("b2 reader %d: got %dB of %dB; retrying after %v", chunkID, i, rsize, b)
-				if err := b.wait(r.ctx); err != nil {
+				if err := b.wait(r.ctx, r.o.b.r.jitter); err != nil {
 					r.setErr(err)
 					r.rcond.Broadcast()
 					return
@@ -185,17 +434,40 @@ func (r *Reader) thread() {
 	}()
 }
 
+// download fetches part of the reader's object, by name or by ID.
+func (r *Reader) download(ctx context.Context, offset, size int64, header bool) (beFileReaderInterface, error) {
+	if r.id != "" {
+		return r.o.b.c.backend.downloadFileByID(ctx, r.id, offset, size, header)
+	}
+	return r.o.b.b.downloadFileByName(ctx, r.name, offset, size, header)
+}
+
+// currentSize returns the size of the object the reader reads, as B2 now
+// reports it.
+func (r *Reader) currentSize() (int64, error) {
+	fr, err := r.download(r.ctx, 0, 0, true)
+	if err != nil {
+		return 0, err
+	}
+	defer fr.Close()
+	size, _, _, _ := fr.stats()
+	return int64(size), nil
+}
+
 func (r *Reader) curChunk() (*rchunk, error) {
 	ch := make(chan *rchunk)
+	// Reset and Seek replace ctx and rcond; this goroutine keeps the ones it
+	// started with.
+	ctx, cond := r.ctx, r.rcond
 	go func() {
 		r.rmux.Lock()
 		defer r.rmux.Unlock()
-		for r.chunks[r.chrid] == nil && r.getErr() == nil && r.ctx.Err() == nil {
-			r.rcond.Wait()
+		for r.chunks[r.chrid] == nil && r.getErr() == nil && ctx.Err() == nil {
+			cond.Wait()
 		}
 		select {
 		case ch <- r.chunks[r.chrid]:
-		case <-r.ctx.Done():
+		case <-ctx.Done():
 			return
 		}
 	}()
@@ -224,15 +496,72 @@ func (r *Reader) initFunc() {
 		r.ChunkSize = 1e7
 	}
 	r.csize = r.ChunkSize
+	if r.MaxBytes > 0 && (r.length < 0 || r.length > r.MaxBytes) {
+		// One extra byte tells us whether the limit was exceeded.
+		r.length = r.MaxBytes + 1
+	}
+	if r.ProgressFunc != nil {
+		r.ptotal = r.total()
+		r.ptime = time.Now()
+	}
 	r.chbuf = make(chan *rchunk, cr)
 	for i := 0; i < cr; i++ {
 		r.thread()
-		r.chbuf <- &rchunk{}
+		buf := &rchunk{}
+		if n := len(r.pool); n > 0 {
+			buf = r.pool[n-1]
+			r.pool = r.pool[:n-1]
+		}
+		r.chbuf <- buf
 	}
 	r.vrfy = sha1.New()
 }
 
+// total returns the number of bytes the reader will read, or -1 if that
+// can't be learned.
+func (r *Reader) total() int64 {
+	attrs, err := r.o.Attrs(r.ctx)
+	if err != nil {
+		return -1
+	}
+	n := attrs.Size - r.offset
+	if n < 0 {
+		n = 0
+	}
+	if r.length >= 0 && r.length < n {
+		// length includes the extra byte that detects exceeding MaxBytes.
+		n = r.length
+	}
+	if r.MaxBytes > 0 && r.MaxBytes < n {
+		n = r.MaxBytes
+	}
+	return n
+}
+
+// Reporting is limited to every progressBytes bytes or progressInterval.
+const (
+	progressBytes    = 1 << 20
+	progressInterval = 100 * time.Millisecond
+)
+
+// progress reports the bytes read to ProgressFunc, if enough has been read
+// since the last report, or if final is true.
+func (r *Reader) progress(final bool) {
+	if r.ProgressFunc == nil || r.read == r.pread && (!final || r.pcalled) {
+		return
+	}
+	if !final && r.read-r.pread < progressBytes && time.Since(r.ptime) < progressInterval {
+		return
+	}
+	r.pread = r.read
+	r.ptime = time.Now()
+	r.pcalled = true
+	r.ProgressFunc(int64(r.read), r.ptotal)
+}
+
 func (r *Reader) Read(p []byte) (int, error) {
+	atomic.AddInt32(&r.reading, 1)
+	defer atomic.AddInt32(&r.reading, -1)
 	if err := r.getErr(); err != nil {
 		return 0, err
 	}
@@ -243,11 +572,32 @@ func (r *Reader) Read(p []byte) (int, error) {
 		return 0, err
 	}
 	n, err := chunk.Read(p)
+	if r.MaxBytes > 0 && int64(r.read+n) > r.MaxBytes {
+		n = int(r.MaxBytes) - r.read
+		r.vrfy.Write(p[:n])
+		r.read += n
+		r.progress(true)
+		r.setErr(ErrMaxBytes)
+		return n, ErrMaxBytes
+	}
 	r.vrfy.Write(p[:n]) // Hash.Write never returns an error.
 	r.read += n
 	if err == io.EOF {
+		if r.VerifyProgressFunc != nil && r.read > r.vread {
+			r.vread = r.read
+			r.VerifyProgressFunc(int64(r.read))
+		}
 		if chunk.final {
 			close(r.chbuf)
+			r.progress(true)
+			if r.VerifySHA1 {
+				if verr, ok := r.Verify(); !ok {
+					r.vskipped = true
+				} else if verr != nil {
+					r.verr = fmt.Errorf("b2: %s: %v", r.name, verr)
+					err = r.verr
+				}
+			}
 			r.setErrNoCancel(err)
 			return n, err
 		}
@@ -256,6 +606,7 @@ func (r *Reader) Read(p []byte) (int, error) {
 		r.chbuf <- chunk
 		err = nil
 	}
+	r.progress(false)
 	r.setErrNoCancel(err)
 	return n, err
 }
@@ -282,7 +633,11 @@ func (r *Reader) status() *ReaderStatus {
 // hash was not sent), this returns (nil, false).
 func (r *Reader) Verify() (error, bool) {
 	got := fmt.Sprintf("%x", r.vrfy.Sum(nil))
-	if r.sha1 == got {
+	r.rmux.Lock()
+	want := r.sha1
+	offEnd := r.readOffEnd
+	r.rmux.Unlock()
+	if want == got {
 		return nil, true
 	}
 	// TODO: if the exact length of the file is requested AND the checksum is
@@ -290,10 +645,177 @@ func (r *Reader) Verify() (error, bool) {
 	// because there's no good way that I can tell to determine that we've hit
 	// the end of the file without reading off the end.  Consider reading N+1
 	// bytes at the very end to close this hole.
-	if r.offset > 0 || !r.readOffEnd || len(r.sha1) != 40 {
+	if r.offset > 0 || !offEnd || len(want) != 40 {
 		return nil, false
 	}
-	return fmt.Errorf("bad hash: got %v, want %v", got, r.sha1), true
+	return fmt.Errorf("bad hash: got %v, want %v", got, want), true
+}
+
+// A DownloadOption alters the behavior of Bucket.DownloadBytes.
+type DownloadOption func(*downloadOptions)
+
+type downloadOptions struct {
+	max int64
+}
+
+// MaxDownloadBytes causes DownloadBytes to fail with ErrMaxBytes, without
+// reading the object's contents, if the object is larger than n bytes.
+func MaxDownloadBytes(n int64) DownloadOption {
+	return func(o *downloadOptions) {
+		o.max = n
+	}
+}
+
+// DownloadBytes reads the whole of the named object into memory, and returns
+// its contents and attributes.  It makes a single request: the buffer is sized,
+// and the attributes built, from the download's response headers.  If the
+// download is cut short, it is retried from the start after a backoff.  If B2
+// has a SHA1 for the object, it is checked against the downloaded bytes.
+func (b *Bucket) DownloadBytes(ctx context.Context, name string, opts ...DownloadOption) ([]byte, *Attrs, error) {
+	var do downloadOptions
+	for _, opt := range opts {
+		opt(&do)
+	}
+	var bo backoff
+	for {
+		fr, err := b.b.downloadFileByName(ctx, name, 0, 0, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		size, ct, sha, info := fr.stats()
+		if do.max > 0 && int64(size) > do.max {
+			fr.Close()
+			return nil, nil, ErrMaxBytes
+		}
+		buf := make([]byte, size)
+		n, err := io.ReadFull(fr, buf)
+		fr.Close()
+		// ReadFull returns io.EOF if the connection drops before the first
+		// byte.
+		if err == io.ErrUnexpectedEOF || (err == io.EOF && size > 0) {
+			blog.V(1).Infof("b2 download %s: got %dB of %dB; retrying after %v", name, n, size, bo)
+			if err := bo.wait(ctx, b.r.jitter); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		attrs, err := fileAttrs(&beFileInfo{
+			name:   name,
+			sha:    sha,
+			size:   int64(size),
+			ct:     ct,
+			info:   headerInfo(info),
+			status: "upload",
+			stamp:  fr.uploaded(),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(attrs.SHA1) == 40 {
+			if got := fmt.Sprintf("%x", sha1.Sum(buf)); got != attrs.SHA1 {
+				return nil, nil, fmt.Errorf("bad hash: got %v, want %v", got, attrs.SHA1)
+			}
+		}
+		return buf, attrs, nil
+	}
+}
+
+// headerInfo returns the file info from a download's X-Bz-Info headers, whose
+// names have been canonicalized, under the lower-case names B2 stores.
+func headerInfo(info map[string]string) map[string]string {
+	m := make(map[string]string, len(info))
+	for k, v := range info {
+		m[strings.ToLower(k)] = v
+	}
+	return m
+}
+
+// DownloadRangeTo copies length bytes of the named object, starting at offset,
+// into w.  If length is negative, the rest of the object is copied.  If the
+// connection to B2 is interrupted, the download is resumed from the last byte
+// written to w, after a backoff.  Errors from w are not retried.
+//
+// It returns the number of bytes written to w.  Reaching the end of the object
+// before length bytes have been copied is not an error.
+func (b *Bucket) DownloadRangeTo(ctx context.Context, name string, offset, length int64, w io.Writer) (int64, error) {
+	ew := &errWriter{w: w}
+	var written int64
+	var bo backoff
+	for {
+		var size int64
+		if length >= 0 {
+			size = length - written
+			if size <= 0 {
+				return written, nil
+			}
+		}
+		fr, err := b.b.downloadFileByName(ctx, name, offset+written, size, false)
+		if err == errNoMoreContent {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		clen, _, _, _ := fr.stats()
+		n, err := copyWait(ctx, ew, fr)
+		written += n
+		if ew.err != nil {
+			return written, ew.err
+		}
+		if ctx.Err() != nil {
+			return written, ctx.Err()
+		}
+		if err == nil && n >= int64(clen) {
+			return written, nil
+		}
+		blog.V(1).Infof("b2 download %s: got %dB of %dB (%v); retrying after %v", name, n, clen, err, bo)
+		if err := bo.wait(ctx, b.r.jitter); err != nil {
+			return written, err
+		}
+	}
+}
+
+// copyWait copies fr to ew, and closes fr.  If ctx is done first, fr is closed
+// to stop the copy, and copyWait waits for it, so that nothing is written to
+// ew after it returns.  It returns the number of bytes written to ew, counted
+// by ew itself.
+func copyWait(ctx context.Context, ew *errWriter, fr io.ReadCloser) (int64, error) {
+	before := ew.n
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(ew, fr)
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+		fr.Close()
+	case <-ctx.Done():
+		fr.Close()
+		<-done
+		err = ctx.Err()
+	}
+	return ew.n - before, err
+}
+
+// errWriter records any error returned by w, so that it can be distinguished
+// from errors reading the source, and counts the bytes w accepts.
+type errWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	n, err := ew.w.Write(p)
+	ew.n += int64(n)
+	if err != nil {
+		ew.err = err
+	}
+	return n, err
 }
 
 // strip a writer of any non-Write methods
@@ -302,14 +824,22 @@ type onlyWriter struct{ w io.Writer }
 func (ow onlyWriter) Write(p []byte) (int, error) { return ow.w.Write(p) }
 
 func copyContext(ctx context.Context, w io.Writer, r io.Reader) (int64, error) {
+	return runContext(ctx, func() (int64, error) {
+		if _, ok := w.(*Writer); ok {
+			w = onlyWriter{w}
+		}
+		return io.Copy(w, r)
+	})
+}
+
+// runContext runs f, but returns early if ctx is done first.  f may still be
+// running when runContext returns.
+func runContext(ctx context.Context, f func() (int64, error)) (int64, error) {
 	var n int64
 	var err error
 	done := make(chan struct{})
 	go func() {
-		if _, ok := w.(*Writer); ok {
-			w = onlyWriter{w}
-		}
-		n, err = io.Copy(w, r)
+		n, err = f()
 		close(done)
 	}()
 	select {
@@ -328,12 +858,13 @@ func (noopResetter) Reset() error { return nil }
 
 type backoff time.Duration
 
-func (b *backoff) wait(ctx context.Context) error {
+// wait sleeps for the backoff, as randomized by jitter, and then doubles it.
+func (b *backoff) wait(ctx context.Context, jitter func(time.Duration) time.Duration) error {
 	if *b == 0 {
 		*b = backoff(time.Millisecond)
 	}
 	select {
-	case <-time.After(time.Duration(*b)):
+	case <-time.After(jitter(time.Duration(*b))):
 		if time.Duration(*b) < time.Second*10 {
 			*b <<= 1
 		}
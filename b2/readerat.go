@@ -15,10 +15,83 @@
 package b2
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"sync"
 )
 
+// A ReaderAt reads an object at arbitrary offsets, one ranged request per
+// call, which suits tools such as archive/zip that read a few scattered
+// regions of a large file.  It does no read-ahead or buffering, so for
+// sequential reads a Reader will be much faster.
+//
+// ReadAt may be called concurrently.  Requests share the client's
+// authorization and HTTP connections.
+type ReaderAt struct {
+	ctx context.Context
+	o   *Object
+
+	mu   sync.Mutex
+	size int64 // -1 until known
+}
+
+// NewReaderAt returns a ReaderAt for the object.  Reads use ctx.
+func (o *Object) NewReaderAt(ctx context.Context) *ReaderAt {
+	return &ReaderAt{
+		ctx:  ctx,
+		o:    o,
+		size: -1,
+	}
+}
+
+// Size returns the size of the object, from its attributes.  The size is
+// fetched on first use and then cached.
+func (r *ReaderAt) Size() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size >= 0 {
+		return r.size, nil
+	}
+	attrs, err := r.o.Attrs(r.ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.size = attrs.Size
+	return r.size, nil
+}
+
+// ReadAt reads len(p) bytes of the object, starting at off.  As io.ReaderAt
+// requires, it returns io.EOF if fewer bytes remain.  Dropped connections
+// are retried from the last byte received.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("b2: ReadAt: negative offset")
+	}
+	size, err := r.Size()
+	if err != nil {
+		return 0, err
+	}
+	if off >= size {
+		return 0, io.EOF
+	}
+	want := int64(len(p))
+	if rem := size - off; want > rem {
+		want = rem
+	}
+	buf := bytes.NewBuffer(p[:0])
+	n, err := r.o.b.DownloadRangeTo(r.ctx, r.o.name, off, want, buf)
+	copy(p, buf.Bytes()[:n])
+	if err != nil {
+		return int(n), err
+	}
+	if int(n) < len(p) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
 type readerAt struct {
 	rs io.ReadSeeker
 	mu sync.Mutex
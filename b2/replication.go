@@ -0,0 +1,117 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReplicationConfiguration describes a bucket's cloud replication settings.
+// A bucket can act as a replication source (sending objects to other
+// buckets), as a replication destination (receiving objects from other
+// buckets), or both.
+type ReplicationConfiguration struct {
+	// Source, if non-nil, configures this bucket as a replication source.
+	Source *ReplicationSource
+
+	// Destination, if non-nil, configures this bucket as a replication
+	// destination.
+	Destination *ReplicationDestination
+}
+
+// ReplicationSource holds the settings for a bucket that replicates its
+// objects to other buckets.
+type ReplicationSource struct {
+	// KeyID is the ID of the application key B2 uses to read objects from
+	// this bucket.
+	KeyID string
+
+	// Rules lists the replication rules.  At least one is required.
+	Rules []ReplicationRule
+}
+
+// A ReplicationRule describes which objects are replicated, and where.
+type ReplicationRule struct {
+	// Name identifies the rule.  Names must be unique within a bucket.
+	Name string
+
+	// DestinationBucketID is the ID of the bucket that receives objects.
+	DestinationBucketID string
+
+	// Prefix restricts the rule to objects whose names begin with Prefix.
+	Prefix string
+
+	// Priority determines which rule applies when more than one matches.
+	// It must be between 1 and 2147483647.
+	Priority int
+
+	// Enabled reports or sets whether the rule is active.
+	Enabled bool
+
+	// IncludeExisting requests that objects uploaded before the rule was
+	// created also be replicated.
+	IncludeExisting bool
+}
+
+// ReplicationDestination holds the settings for a bucket that receives
+// replicated objects.
+type ReplicationDestination struct {
+	// KeyMapping maps source application key IDs to the application key IDs
+	// that are used to write into this bucket.  At least one entry is
+	// required.
+	KeyMapping map[string]string
+}
+
+func (rc *ReplicationConfiguration) validate() error {
+	if rc.Source == nil && rc.Destination == nil {
+		return nil
+	}
+	if src := rc.Source; src != nil {
+		if src.KeyID == "" {
+			return errors.New("replication source requires an application key ID")
+		}
+		if len(src.Rules) == 0 {
+			return errors.New("replication source requires at least one rule")
+		}
+		names := make(map[string]bool)
+		for _, rule := range src.Rules {
+			if rule.Name == "" {
+				return errors.New("replication rules must be named")
+			}
+			if names[rule.Name] {
+				return fmt.Errorf("%s: duplicate replication rule name", rule.Name)
+			}
+			names[rule.Name] = true
+			if rule.DestinationBucketID == "" {
+				return fmt.Errorf("%s: replication rule requires a destination bucket ID", rule.Name)
+			}
+			if rule.Priority < 1 || rule.Priority > 1<<31-1 {
+				return fmt.Errorf("%s: replication rule priority %d out of range", rule.Name, rule.Priority)
+			}
+		}
+	}
+	if dst := rc.Destination; dst != nil {
+		if len(dst.KeyMapping) == 0 {
+			return errors.New("replication destination requires at least one key mapping")
+		}
+		for src, dstKey := range dst.KeyMapping {
+			if src == "" || dstKey == "" {
+				return fmt.Errorf("replication destination has an invalid key mapping %q: %q", src, dstKey)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// resumeToken is the state a writer needs to continue a large file in
+// another process.
+type resumeToken struct {
+	FileID    string         `json:"fileId"`
+	Name      string         `json:"name"`
+	ChunkSize int            `json:"chunkSize"`
+	Parts     map[int]string `json:"parts,omitempty"`
+}
+
+func parseResumeToken(token string) (*resumeToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("b2: invalid resume token: %v", err)
+	}
+	tok := &resumeToken{}
+	if err := json.Unmarshal(b, tok); err != nil {
+		return nil, fmt.Errorf("b2: invalid resume token: %v", err)
+	}
+	if tok.FileID == "" || tok.Name == "" || tok.ChunkSize <= 0 {
+		return nil, errors.New("b2: invalid resume token: missing file ID, name, or chunk size")
+	}
+	return tok, nil
+}
+
+// ResumeToken returns an opaque token from which NewWriterFromResumeToken can
+// continue this writer's large file, for instance after the process restarts.
+// It records the parts that B2 has received so far, and so is best taken
+// after Close, or after a failed Write.  It is an error to call ResumeToken
+// before the writer has started a large file, or concurrently with Write.
+//
+// A resumed writer cuts its parts at the recorded chunk size from the start.
+// If AdaptiveChunkSizing has shrunk this writer's parts, they cannot be cut
+// the same way again, and ResumeToken returns an error.
+func (w *Writer) ResumeToken() (string, error) {
+	if w.file == nil {
+		return "", fmt.Errorf("b2: %s: writer has not started a large file", w.name)
+	}
+	if w.resized {
+		return "", fmt.Errorf("b2: %s: AdaptiveChunkSizing changed the chunk size; the large file cannot be resumed", w.name)
+	}
+	tok := resumeToken{
+		FileID:    w.file.id(),
+		Name:      w.name,
+		ChunkSize: w.csize,
+		Parts:     make(map[int]string),
+	}
+	w.hmux.Lock()
+	for id, sha := range w.seen {
+		tok.Parts[id] = sha
+	}
+	for id, sha := range w.sent {
+		tok.Parts[id] = sha
+	}
+	w.hmux.Unlock()
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewWriterFromResumeToken returns a writer that continues the large file
+// described by token, which must come from Writer.ResumeToken.  The caller
+// must write the object's contents again from the beginning; parts that B2
+// already holds are checked against the new data and are not re-sent.
+//
+// If the large file has since been finished or cancelled, the returned error
+// satisfies IsNotExist.
+func (b *Bucket) NewWriterFromResumeToken(ctx context.Context, token string, opts ...WriterOption) (*Writer, error) {
+	tok, err := parseResumeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := b.UnfinishedLargeFiles(ctx, tok.Name)
+	if err != nil {
+		return nil, err
+	}
+	var found bool
+	for _, obj := range objs {
+		if obj.f.id() == tok.FileID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, b2err{
+			err:         fmt.Errorf("b2: resume token: large file %s (%s) no longer exists", tok.Name, tok.FileID),
+			notFoundErr: true,
+		}
+	}
+	w := b.Object(tok.Name).NewWriter(ctx, opts...)
+	w.Resume = true
+	w.ChunkSize = tok.ChunkSize
+	w.ExpectResumeFileID = tok.FileID
+	w.ResumeSelector = func(cands []*Object) *Object {
+		for _, c := range cands {
+			if c.f.id() == tok.FileID {
+				return c
+			}
+		}
+		return nil
+	}
+	w.tokenParts = tok.Parts
+	return w, nil
+}
+
+// checkTokenParts verifies that B2 still holds every part that the writer's
+// resume token recorded.
+func (w *Writer) checkTokenParts(seen map[int]string) error {
+	for id, sha := range w.tokenParts {
+		got, ok := seen[id]
+		if !ok {
+			return fmt.Errorf("resume %s: token records part %d, which B2 does not hold", w.name, id)
+		}
+		if got != sha {
+			return fmt.Errorf("resume %s: part %d: B2 has SHA1 %s, token records %s", w.name, id, got, sha)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A RetryPolicy decides whether, and when, a client retries a failed request.
+// It is consulted only for failures that can be retried: connection errors,
+// and B2's 408, 429, 500, and 503 replies, along with any 5xx reply to an
+// upload.  Other errors are returned at once.
+type RetryPolicy interface {
+	// ShouldRetry is called when the attempt'th try of a request fails
+	// with err.  If retry is true, the request is tried again after wait, or
+	// after as long as B2 asked for with a Retry-After header, whichever is
+	// longer.
+	ShouldRetry(attempt int, err error) (retry bool, wait time.Duration)
+}
+
+// WithRetryPolicy returns a ClientOption that retries the client's requests,
+// including uploads and downloads, according to p.  It replaces the writer's
+// MaxRetries, MaxPartRetries, RetryBackoff, and MaxBackoff fields, which
+// apply only when the client has no RetryPolicy.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(c *clientOptions) {
+		c.retryPolicy = p
+	}
+}
+
+// ExponentialBackoff is a RetryPolicy that waits Initial before the first
+// retry, and twice as long before each retry after that, up to Max.  It gives
+// up after MaxAttempts attempts; zero means it never does.  If Initial or Max
+// is zero, it is 500ms or 15s respectively.
+type ExponentialBackoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+// ShouldRetry satisfies the RetryPolicy interface.
+func (e ExponentialBackoff) ShouldRetry(attempt int, err error) (bool, time.Duration) {
+	if e.MaxAttempts > 0 && attempt >= e.MaxAttempts {
+		return false, 0
+	}
+	d, max := e.Initial, e.Max
+	if d <= 0 {
+		d = 500 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 15 * time.Second
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return true, d
+}
+
+// WithJitterSeed returns a ClientOption that seeds the pseudo-random source
+// from which the client picks its retry waits, so that they are the same from
+// run to run.  It is intended for tests.
+func WithJitterSeed(seed int64) ClientOption {
+	return func(c *clientOptions) {
+		c.jitter = newJitterSource(seed)
+	}
+}
+
+// A jitterSource spreads out retry waits.
+type jitterSource struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newJitterSource(seed int64) *jitterSource {
+	return &jitterSource{r: rand.New(rand.NewSource(seed))}
+}
+
+// defaultJitter is used by clients without a seed of their own.
+var defaultJitter = newJitterSource(time.Now().UnixNano())
+
+// equal returns a wait chosen at random between d/2 and d, so that requests
+// that fail together, such as a writer's concurrent parts when B2 throttles
+// them, are not retried together.  A nil jitterSource uses defaultJitter.
+func (j *jitterSource) equal(d time.Duration) time.Duration {
+	if j == nil {
+		j = defaultJitter
+	}
+	if d < 2 {
+		return d
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	half := d / 2
+	return half + time.Duration(j.r.Int63n(int64(d-half)+1))
+}
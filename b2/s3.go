@@ -0,0 +1,212 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Endpoint describes B2's S3-compatible API for a client's account, so that
+// callers can hand individual operations to S3 tooling.  B2 accepts the
+// account's key ID and application key as S3 credentials.
+type S3Endpoint struct {
+	// URL is the S3 API endpoint, e.g. https://s3.us-west-002.backblazeb2.com.
+	URL string
+
+	// Region is the S3 region named by URL.
+	Region string
+
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3 returns the S3-compatible endpoint and credentials for the client's
+// account.  It returns an error if B2 did not report an S3 endpoint.
+func (c *Client) S3() (*S3Endpoint, error) {
+	u := c.S3APIURL()
+	if u == "" {
+		return nil, errors.New("b2: the service did not report an S3 API URL")
+	}
+	region, err := s3Region(u)
+	if err != nil {
+		return nil, err
+	}
+	account, key := c.backend.credentials()
+	return &S3Endpoint{
+		URL:             u,
+		Region:          region,
+		AccessKeyID:     account,
+		SecretAccessKey: key,
+	}, nil
+}
+
+// s3Region extracts the region from an endpoint of the form
+// https://s3.<region>.backblazeb2.com.
+func s3Region(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("b2: S3 API URL %q: %v", endpoint, err)
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) < 3 || labels[0] != "s3" {
+		return "", fmt.Errorf("b2: S3 API URL %q does not name a region", endpoint)
+	}
+	return labels[1], nil
+}
+
+// Transport returns a RoundTripper that signs each request with the
+// endpoint's credentials (AWS Signature Version 4) and sends it with rt.  If
+// rt is nil, http.DefaultTransport is used.  Request bodies are not included
+// in the signature.
+func (e *S3Endpoint) Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &s3Transport{e: e, rt: rt, now: time.Now}
+}
+
+type s3Transport struct {
+	e   *S3Endpoint
+	rt  http.RoundTripper
+	now func() time.Time
+}
+
+func (t *s3Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req := new(http.Request)
+	*req = *r
+	req.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signV4(req, t.e.AccessKeyID, t.e.SecretAccessKey, t.e.Region, "s3", "UNSIGNED-PAYLOAD", t.now())
+	return t.rt.RoundTrip(req)
+}
+
+// signV4 sets the X-Amz-Date and Authorization headers of req.  Every header
+// already on req is signed, along with Host.
+func signV4(req *http.Request, keyID, secret, region, service, payloadHash string, now time.Time) {
+	now = now.UTC()
+	stamp := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", stamp)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		vals := make([]string, len(v))
+		for i := range v {
+			// Trimmed, with inner runs of whitespace collapsed to one space.
+			vals[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(vals, ",")
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+
+	canon := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{day, region, service, "aws4_request"}, "/")
+	sum := sha256.Sum256([]byte(canon))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", stamp, scope, hex.EncodeToString(sum[:])}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, s := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signed, sig))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// canonicalPath encodes the decoded path p as SigV4 requires for S3: each
+// segment URI-encoded once, with everything but unreserved characters
+// percent-encoded.  Go's own escaping leaves characters such as "=" and "@"
+// alone, which S3 would not.
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = uriEncode(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// uriEncode percent-encodes every byte of s except the unreserved characters
+// A-Z, a-z, 0-9, "-", ".", "_", and "~".
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes q as SigV4 requires: sorted, with spaces as %20 and
+// tildes left alone.
+func canonicalQuery(q url.Values) string {
+	esc := func(s string) string {
+		return strings.Replace(strings.Replace(url.QueryEscape(s), "+", "%20", -1), "%7E", "~", -1)
+	}
+	var parts []string
+	for k, vs := range q {
+		for _, v := range vs {
+			parts = append(parts, esc(k)+"="+esc(v))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,103 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// NewTailReader returns a reader that follows the named object, in the manner
+// of "tail -f".  When the reader reaches the end of the object, it polls B2
+// every poll interval until a newer version of the object is larger than what
+// has already been read, and then continues reading from where it left off.
+// Reads block until new data is available, the context is cancelled, or the
+// reader is closed.
+//
+// This is a best-effort facility.  B2 objects are immutable, so "growing" an
+// object means uploading a new version that begins with the old contents; the
+// tail reader does not verify that this is so, and only makes sense for
+// objects that are updated in an append-only fashion.  If a new version is
+// shorter than what has already been read, it is ignored until it is larger.
+func (b *Bucket) NewTailReader(ctx context.Context, name string, poll time.Duration) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	return &tailReader{
+		ctx:    ctx,
+		cancel: cancel,
+		o:      b.Object(name),
+		poll:   poll,
+	}
+}
+
+type tailReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	o      *Object
+	poll   time.Duration
+	offset int64
+	r      *Reader
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		if t.r == nil {
+			t.r = t.o.NewRangeReader(t.ctx, t.offset, -1)
+		}
+		n, err := t.r.Read(p)
+		t.offset += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		t.r.Close()
+		t.r = nil
+		if n > 0 {
+			return n, nil
+		}
+		if err := t.wait(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// wait blocks until the object is larger than what has been read.
+func (t *tailReader) wait() error {
+	for {
+		if err := sleepCtx(t.ctx, t.poll); err != nil {
+			return err
+		}
+		fr, err := t.o.b.b.downloadFileByName(t.ctx, t.o.name, 0, 0, true)
+		if err != nil {
+			if IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		io.Copy(discard{}, fr)
+		fr.Close()
+		size, _, _, _ := fr.stats()
+		if int64(size) > t.offset {
+			return nil
+		}
+	}
+}
+
+func (t *tailReader) Close() error {
+	t.cancel()
+	if t.r != nil {
+		return t.r.Close()
+	}
+	return nil
+}
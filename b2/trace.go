@@ -0,0 +1,95 @@
+// Copyright 2018, the Blazer authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package b2
+
+import "context"
+
+// An Op describes a single B2 API call, as reported to a Tracer.
+type Op struct {
+	// API is the name of the B2 call, e.g. "b2_upload_part".
+	API string
+
+	// Bucket and Name are the bucket and object the call concerns, if any.
+	Bucket string
+	Name   string
+
+	// Size is the number of bytes sent or requested, if known.
+	Size int64
+
+	// Part is the part number, for b2_upload_part.
+	Part int
+}
+
+// A Tracer is told about the B2 calls a client makes: authorization, simple
+// and large file uploads, downloads, and listings.  It is intended as a thin
+// hook for tracing systems such as OpenTelemetry, whose adapters live outside
+// this module so that package b2 has no dependencies beyond the standard
+// library.  An adapter would typically start a client span named op.API, with
+// the op's other fields as attributes, record each retry as a span event, and
+// record the error passed to End.
+type Tracer interface {
+	// StartOp is called before op is first attempted.  The returned context
+	// is used for the call and its retries, so that anything beneath it, such
+	// as an instrumented transport, is attributed to the operation.
+	StartOp(ctx context.Context, op Op) (context.Context, OpSpan)
+}
+
+// An OpSpan is a single traced operation.
+type OpSpan interface {
+	// Retry is called each time the operation fails with an error after which
+	// it will be retried.
+	Retry(err error)
+
+	// End is called exactly once, when the operation finishes.  err is the
+	// operation's final error, if any.
+	End(err error)
+}
+
+// WithTracer returns a ClientOption that reports the client's B2 calls to t.
+func WithTracer(t Tracer) ClientOption {
+	return func(c *clientOptions) {
+		c.tracer = t
+	}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) Retry(error) {}
+func (nopSpan) End(error)   {}
+
+type spanKey struct{}
+
+// startOp begins tracing op with the tracer configured on ri, if any.  The
+// returned context carries the span so that withBackoff can note retries.
+func startOp(ctx context.Context, ri beRootInterface, op Op) (context.Context, OpSpan) {
+	if ri == nil {
+		return ctx, nopSpan{}
+	}
+	t := ri.tracer()
+	if t == nil {
+		return ctx, nopSpan{}
+	}
+	ctx, sp := t.StartOp(ctx, op)
+	if sp == nil {
+		return ctx, nopSpan{}
+	}
+	return context.WithValue(ctx, spanKey{}, sp), sp
+}
+
+func retried(ctx context.Context, err error) {
+	if sp, ok := ctx.Value(spanKey{}).(OpSpan); ok {
+		sp.Retry(err)
+	}
+}
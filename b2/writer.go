@@ -16,14 +16,21 @@ package b2
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/kurin/blazer/internal/blog"
 )
 
 // Writer writes data into Backblaze.  It automatically switches to the large
@@ -39,18 +46,128 @@ type Writer struct {
 	// buffer for each thread.  Values less than 1 are equivalent to 1.
 	ConcurrentUploads int
 
+	// WarmUploadURLs causes a large file's writer to fetch an upload URL for
+	// each of its ConcurrentUploads threads before sending the first part,
+	// rather than as each part first needs one.  This avoids a slow start to
+	// large uploads.  A URL that goes stale is replaced as usual.
+	WarmUploadURLs bool
+
 	// Resume an upload.  If true, and the upload is a large file, and a file of
 	// the same name was started but not finished, then assume that we are
 	// resuming that file, and don't upload duplicate chunks.
 	Resume bool
 
+	// RestartOnResumeMismatch, when resuming, checks the parts that B2 already
+	// holds against the source before uploading, and if they differ, cancels
+	// the unfinished large file and uploads the source as a new file, rather
+	// than failing.  The check re-reads the source, and so is made only when
+	// the writer is given an io.ReadSeeker via ReadFrom (as io.Copy does); with
+	// any other source, a mismatch still fails the upload.  Parts numbered by
+	// PartNumbers are not checked.
+	RestartOnResumeMismatch bool
+
+	// WriteManifest causes Close, after finishing a large file, to upload a
+	// second object, named for the first with ".manifest.json" appended,
+	// that lists the file's ID and size and each part's number, size, and
+	// SHA1.  Files sent in a single request get no manifest.  If only the
+	// manifest fails to upload, the error from Close satisfies
+	// IsManifestError.
+	WriteManifest bool
+
+	// DeleteOlderVersionsOnClose causes Close, once the object has been
+	// uploaded, to permanently delete every older version of its name.  A
+	// write then replaces the object rather than adding a version.  This is
+	// destructive, and cannot be undone: the deleted versions are gone, not
+	// hidden.  That includes versions that other writers uploaded to the same
+	// name concurrently, if they finished before this one did.  Versions are
+	// deleted only after the upload succeeds; if any cannot be deleted, Close
+	// returns the error, although the object has been written.
+	//
+	// There is no option to hide the older versions instead.  B2 hides a name
+	// by making a hide marker its newest version, which would hide the new
+	// upload too, and older versions are already hidden behind the new one.
+	DeleteOlderVersionsOnClose bool
+
+	// RestartOnInvalidParts, when resuming, cancels an unfinished large file
+	// that B2 could never finish, because a part other than its last is
+	// smaller than 5MB, and uploads the source as a new file.  Such files are
+	// left by faulty uploaders.  Without it, the writer fails with an error
+	// naming the bad part.  It has no effect if ExpectResumeFileID is set.
+	RestartOnInvalidParts bool
+
+	// VerifyResumedParts, when resuming, checks before finishing the file that
+	// every part B2 already held was also produced by this writer, with the
+	// same SHA1.  This catches a prior upload that had more, or different,
+	// parts than this one.
+	VerifyResumedParts bool
+
+	// ResumeSelector, when resuming, chooses which of several unfinished large
+	// files with the writer's name to resume.  If it returns nil, a new large
+	// file is started.  If ResumeSelector is nil, the last file listed is
+	// resumed.  Bucket.UnfinishedLargeFiles lists the same candidates.
+	ResumeSelector func(candidates []*Object) *Object
+
+	// ExpectResumeFileID, if set, is the ID of the unfinished large file that
+	// a resumed upload must continue.  If the file chosen for resumption has a
+	// different ID, or there is no file to resume, the upload fails.
+	ExpectResumeFileID string
+
+	// FirstPart is the part number of the writer's first part, when writing a
+	// large file.  Later parts are numbered sequentially.  Values less than 1
+	// are equivalent to 1.
+	FirstPart int
+
+	// PartNumbers, if non-nil, is called to number each part in turn, instead
+	// of numbering parts sequentially from FirstPart.  It lets several
+	// writers, in one process or many, contribute non-overlapping sets of
+	// parts to the same large file.
+	PartNumbers func() int
+
+	// LeaveUnfinished causes Close to send every part but not finish the
+	// large file, even if the file is small, so that other writers may add
+	// parts.  A last writer, with Resume set, finishes the file; it learns of
+	// existing parts when it starts, and so should be started after the other
+	// writers have closed.  Before finishing, the writer checks that the parts
+	// are numbered contiguously from 1.
+	LeaveUnfinished bool
+
+	// LargeFileSHA1 causes a large file to be started with the SHA1 of its
+	// entire contents in the large_file_sha1 info key, which B2 otherwise
+	// cannot report for large files.  B2 accepts file info only when a large
+	// file is started, so the SHA1 must be known before the first part is
+	// sent: either supplied, with WithSHA1 or in the SHA1 field of
+	// WithAttrsOption, or computed, by reading the source an extra time, when
+	// the writer is given an io.ReadSeeker via ReadFrom.  Otherwise the file is
+	// uploaded without the key, and this is logged at V(1).
+	LargeFileSHA1 bool
+
+	// ComputeCRC32C causes the writer to store the CRC-32C (Castagnoli) of the
+	// object's contents, as eight hex digits, in the crc32c info key, for
+	// consumers that check CRCs rather than SHA1s.  B2's own SHA1 checks are
+	// unaffected.  As with LargeFileSHA1, a large file's CRC must be known
+	// when it is started, and so is only computed for large files given to
+	// ReadFrom as an io.ReadSeeker.  Other large files are uploaded without
+	// the key, and this is logged at V(1).
+	ComputeCRC32C bool
+
 	// ChunkSize is the size, in bytes, of each individual part, when writing
 	// large files, and also when determining whether to upload a file normally
 	// or when to split it into parts.  The default is 100M (1e8)  The minimum is
 	// 5M (5e6); values less than this are not an error, but will fail.  The
 	// maximum is 5GB (5e9).
+	//
+	// Every part but the last holds exactly ChunkSize bytes, however the data
+	// is written, so uploads of the same bytes with the same ChunkSize have the
+	// same parts and part SHA1s.  AdaptiveChunkSizing, which sizes parts by
+	// measured throughput, gives up this guarantee.
 	ChunkSize int
 
+	// ExpectedSize, if positive, is the size the object is expected to be.
+	// It is only a hint: in-memory buffers are allocated up front with room
+	// for ChunkSize bytes or ExpectedSize bytes, whichever is less, rather
+	// than growing as data is written.  Writing more or less is not an error.
+	ExpectedSize int64
+
 	// UseFileBuffer controls whether to use an in-memory buffer (the default) or
 	// scratch space on the file system.  If this is true, b2 will save chunks in
 	// FileBufferDir.
@@ -60,10 +177,78 @@ type Writer struct {
 	// blank, os.TempDir() is used.
 	FileBufferDir string
 
+	// MaxPartRetries is the number of times an individual part of a large file
+	// will be re-sent, after B2 asks for a new upload attempt, before the
+	// whole upload is abandoned.  Zero means there is no limit.
+	MaxPartRetries int
+
+	// MaxRetries is the number of times the writer re-sends a request to
+	// upload data, either a file sent in one request or a part for which
+	// MaxPartRetries is not set, after B2 asks for a new upload attempt,
+	// before abandoning the upload.  Zero means there is no limit.
+	MaxRetries int
+
+	// RetryBackoff is how long the writer waits before its first retry of an
+	// upload; each later wait is twice as long, up to MaxBackoff.  The
+	// defaults are 15ms and 15s.  Each wait is cut to a random length of at
+	// least half, so that parts throttled together are not retried together.
+	// If B2 asks for a longer wait, with a Retry-After header, the writer
+	// waits that long instead.
+	//
+	// If the client was given a RetryPolicy, it is used instead of these
+	// four fields.
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+
+	// AdaptiveChunkSizing allows the writer to shrink ChunkSize, when the
+	// writer's context has a deadline, so that each part can be sent in the
+	// time remaining.  The writer estimates throughput from the parts it has
+	// already sent, and never shrinks parts below B2's 5MB minimum.  Once it
+	// has done so, the writer's parts follow no fixed size, and ResumeToken
+	// returns an error.
+	AdaptiveChunkSizing bool
+
+	// LogLevel, if positive, causes the writer to log its messages up to this
+	// verbosity, as if B2_LOG_LEVEL were at least LogLevel, without raising the
+	// level for the rest of the package.
+	LogLevel int
+
+	// MaxClockSkew, if positive, causes the writer to log a warning when the
+	// LastModified time given in WithAttrsOption is more than MaxClockSkew
+	// ahead of the local clock, which usually means that one clock or the
+	// other is wrong.  The time is still saved.
+	MaxClockSkew time.Duration
+
+	// UseWriteTimeAsModified records the time of the last Write, or of Close
+	// if nothing was written, as the object's last modified time, in place of
+	// any LastModified given in WithAttrsOption.  It is meant for data, such
+	// as logs, with no timestamp of its own.  The time is saved under the
+	// LastModifiedKey and LastModifiedUnit from WithAttrsOption, if given, and
+	// otherwise as src_last_modified_millis, unless the object already has
+	// B2's limit of ten info keys.  B2 takes a large file's info when the file
+	// is started, so for a large file the time recorded is that of the Write
+	// that filled its first part.
+	UseWriteTimeAsModified bool
+
+	// ProgressFunc, if set, is called as data reaches B2, with the number of
+	// bytes uploaded so far and the object's total size.  For a large file,
+	// it is called after each part, with a total of -1 until Close has
+	// finished the file, when it is called once more with the final size.
+	// Parts of a resumed file that B2 already held are counted as they are
+	// verified.  For a file sent in one request, it is called once, when the
+	// upload completes.  Parts are uploaded concurrently, but calls are
+	// serialized, and never report fewer bytes than an earlier call; the
+	// function should return quickly, since uploads wait for it.
+	// ProgressFunc must be set before the first call to Write.
+	ProgressFunc func(uploaded, total int64)
+
 	contentType string
 	info        map[string]string
 
 	csize       int
+	resized     bool            // AdaptiveChunkSizing has changed csize
+	parent      context.Context // the context given to NewWriter
+	resumable   bool            // Resume was set, before any resume was attempted
 	ctx         context.Context
 	cancel      context.CancelFunc // cancels ctx
 	ctxf        func() context.Context
@@ -75,6 +260,9 @@ type Writer struct {
 	once        sync.Once
 	done        sync.Once
 	file        beLargeFileInterface
+	fileDone    bool // file was finished or cancelled
+	umux        sync.Mutex
+	partURLs    []beFileChunkInterface // idle upload URLs for file
 	seen        map[int]string
 	everStarted bool
 	newBuffer   func() (writeBuffer, error)
@@ -82,14 +270,61 @@ type Writer struct {
 	o    *Object
 	name string
 
-	cidx int
-	w    writeBuffer
+	cidx    int
+	w       writeBuffer
+	written int64 // bytes given to the writer
 
-	emux sync.RWMutex
-	err  error
+	emux   sync.RWMutex
+	err    error
+	timing *RequestTiming // of the request that caused err, if one did
+	began  time.Time
 
 	smux sync.RWMutex
 	smap map[int]*meteredReader
+
+	mmux sync.Mutex
+	mem  int64
+
+	prmux    sync.Mutex
+	uploaded int64 // bytes reported to ProgressFunc
+
+	pmux    sync.Mutex
+	parts   chan int
+	pqueue  []int
+	pwake   chan struct{}
+	pclosed bool
+
+	pamux  sync.Mutex
+	paused chan struct{} // closed by Unpause; nil when not paused
+
+	tmux   sync.Mutex
+	tbytes int64
+	tdur   time.Duration
+
+	hmux    sync.Mutex
+	hashes  map[int]string
+	partIDs map[int]bool
+	sent    map[int]string // parts B2 has received, by SHA1
+	sizes   map[int]int    // the size of each part in sent
+
+	tokenParts map[int]string // parts a resume token says B2 holds
+
+	dispatched map[int]bool // part numbers given to threads; only sendChunk uses it
+
+	tee  io.Writer
+	crc  hash.Hash32
+	sha1 string // from WithSHA1
+
+	lastModified time.Time     // from WithAttrsOption
+	lmKey        string        // the info key for lastModified
+	lmUnit       time.Duration // the unit of lmKey's value
+	lastWrite    time.Time     // for UseWriteTimeAsModified
+
+	// afterClose, if set, is called once Close has finished with B2, with the
+	// upload's error.  An error it returns becomes the error of Close.  If the
+	// writer is stopped instead, as by Cancel, it is called with
+	// errWriterStopped, and what it returns is ignored.
+	afterClose func(error) error
 }
 
 type chunk struct {
@@ -97,25 +332,98 @@ type chunk struct {
 	buf writeBuffer
 }
 
+// A RequestTiming describes the request to B2 that failed an upload.
+type RequestTiming struct {
+	// Elapsed is the time from the start of the upload to the failure.
+	Elapsed time.Duration
+
+	// Retries is the number of times the writer retried the request before
+	// giving up.  Retries made by the client beneath the writer, such as
+	// after connection errors, are not counted.
+	Retries int
+
+	// Last is how long the final attempt took.
+	Last time.Duration
+}
+
+// ErrTiming reports, after Write or Close has returned an error, the timing
+// of the request whose failure caused the error.  A slow final attempt
+// suggests network trouble; a fast one, a rejection by B2.  It returns false
+// if the writer has not failed, or failed other than in a request to upload
+// data, for instance because its context was cancelled.
+func (w *Writer) ErrTiming() (RequestTiming, bool) {
+	w.emux.RLock()
+	defer w.emux.RUnlock()
+	if w.timing == nil {
+		return RequestTiming{}, false
+	}
+	return *w.timing, true
+}
+
+// failRequest sets the writer's error to err, from a request begun at start
+// after the given number of retries.
+func (w *Writer) failRequest(err error, start time.Time, retries int) {
+	now := time.Now()
+	w.setErrTiming(err, &RequestTiming{
+		Elapsed: now.Sub(w.began),
+		Retries: retries,
+		Last:    now.Sub(start),
+	})
+}
+
 func (w *Writer) setErr(err error) {
+	w.setErrTiming(err, nil)
+}
+
+func (w *Writer) setErrTiming(err error, timing *RequestTiming) {
 	if err == nil || err == io.EOF {
 		return
 	}
 	w.emux.Lock()
-	defer w.emux.Unlock()
 	if w.err != nil {
+		w.emux.Unlock()
 		return
 	}
-	blog.V(1).Infof("error writing %s: %v", w.name, err)
+	w.v(1).Infof("error writing %s: %v", w.name, err)
 	w.err = err
+	w.timing = timing
 	w.cancel()
-	if w.ctxf == nil {
+	// As in cancelFile, emux is not held across the call to B2.
+	file, done := w.file, w.fileDone
+	w.emux.Unlock()
+	if w.ctxf == nil || file == nil || done {
+		return
+	}
+	cerr := file.cancel(w.ctxf())
+	if cerr == nil {
+		w.emux.Lock()
+		w.fileDone = true
+		w.emux.Unlock()
+	}
+	if w.errf != nil {
+		w.errf(cerr)
+	}
+}
+
+// checkClockSkew warns if the writer's LastModified time is further in the
+// future than MaxClockSkew allows.
+func (w *Writer) checkClockSkew() {
+	if w.MaxClockSkew <= 0 || w.lastModified.IsZero() {
 		return
 	}
-	if w.errf == nil {
-		w.errf = func(error) {}
+	if ahead := time.Until(w.lastModified); ahead > w.MaxClockSkew {
+		w.logger().Errorf("b2 writer: %s: last modified time %v is %v in the future; check for clock skew", w.name, w.lastModified, ahead.Round(time.Second))
+	}
+}
+
+// v returns a logger for the writer's messages at the given verbosity.
+// Messages at or below LogLevel are always logged.
+func (w *Writer) v(level int32) InfoLogger {
+	l := w.logger()
+	if int(level) <= w.LogLevel {
+		return l
 	}
-	w.errf(w.file.cancel(w.ctxf()))
+	return l.V(int(level))
 }
 
 func (w *Writer) getErr() error {
@@ -136,6 +444,74 @@ func (w *Writer) completeChunk(id int) {
 	w.smux.Unlock()
 }
 
+// CompletedParts returns a channel on which the writer sends the number of
+// each part as B2 confirms it.  A file small enough to be sent in a single
+// request is reported as part 1.  Parts that were already uploaded, when
+// resuming, are sent as they are verified.  The channel is closed when Close
+// returns.
+//
+// Part numbers are queued in memory and never block the upload, no matter how
+// slowly they are received, and none are dropped.  However, callers must
+// receive from the channel until it is closed, or goroutines will leak.
+// CompletedParts must be called before the first call to Write.
+func (w *Writer) CompletedParts() <-chan int {
+	w.pmux.Lock()
+	defer w.pmux.Unlock()
+	if w.parts == nil {
+		w.parts = make(chan int)
+		w.pwake = make(chan struct{}, 1)
+		go w.sendParts()
+	}
+	return w.parts
+}
+
+func (w *Writer) sendParts() {
+	for {
+		w.pmux.Lock()
+		if len(w.pqueue) > 0 {
+			id := w.pqueue[0]
+			w.pqueue = w.pqueue[1:]
+			w.pmux.Unlock()
+			w.parts <- id
+			continue
+		}
+		if w.pclosed {
+			w.pmux.Unlock()
+			close(w.parts)
+			return
+		}
+		w.pmux.Unlock()
+		<-w.pwake
+	}
+}
+
+func (w *Writer) wakeParts() {
+	select {
+	case w.pwake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Writer) partDone(id int) {
+	w.pmux.Lock()
+	defer w.pmux.Unlock()
+	if w.parts == nil {
+		return
+	}
+	w.pqueue = append(w.pqueue, id)
+	w.wakeParts()
+}
+
+func (w *Writer) closeParts() {
+	w.pmux.Lock()
+	defer w.pmux.Unlock()
+	if w.parts == nil || w.pclosed {
+		return
+	}
+	w.pclosed = true
+	w.wakeParts()
+}
+
 var gid int32
 
 func sleepCtx(ctx context.Context, d time.Duration) error {
@@ -147,16 +523,56 @@ func sleepCtx(ctx context.Context, d time.Duration) error {
 	}
 }
 
+// warmUploadURLs fetches n upload part URLs concurrently.
+func (w *Writer) warmUploadURLs(n int) ([]beFileChunkInterface, error) {
+	fcs := make([]beFileChunkInterface, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range fcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fcs[i], errs[i] = w.file.getUploadPartURL(w.ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fcs, nil
+}
+
+// partURL returns an idle upload URL for the writer's large file, fetching a
+// new one if there is none.  B2 allows only one upload at a time to each URL,
+// so the URL is the caller's until it gives it back with putPartURL.
+func (w *Writer) partURL() (beFileChunkInterface, error) {
+	w.umux.Lock()
+	if n := len(w.partURLs); n > 0 {
+		fc := w.partURLs[n-1]
+		w.partURLs = w.partURLs[:n-1]
+		w.umux.Unlock()
+		return fc, nil
+	}
+	w.umux.Unlock()
+	return w.file.getUploadPartURL(w.ctx)
+}
+
+// putPartURL makes fc, which has not failed, available to other parts.
+func (w *Writer) putPartURL(fc beFileChunkInterface) {
+	w.umux.Lock()
+	defer w.umux.Unlock()
+	w.partURLs = append(w.partURLs, fc)
+}
+
+// thread starts a goroutine that uploads parts.  Each part is sent to an idle
+// upload URL, which is kept for later parts unless B2 rejects it.
 func (w *Writer) thread() {
 	w.wg.Add(1)
 	go func() {
 		defer w.wg.Done()
 		id := atomic.AddInt32(&gid, 1)
-		fc, err := w.file.getUploadPartURL(w.ctx)
-		if err != nil {
-			w.setErr(err)
-			return
-		}
 		for {
 			var cnk chunk
 			select {
@@ -164,40 +580,66 @@ func (w *Writer) thread() {
 			case <-w.cdone:
 				return
 			}
+			w.recordHash(cnk.id, cnk.buf.Hash())
+			w.notePart(cnk.id)
 			if sha, ok := w.seen[cnk.id]; ok {
 				if sha != cnk.buf.Hash() {
 					w.setErr(errors.New("resumable upload was requested, but chunks don't match"))
+					cnk.buf.Close() // TODO: log error
 					return
 				}
+				w.partSent(cnk.id, sha, cnk.buf.Len())
+				w.progress(int64(cnk.buf.Len()), -1)
 				cnk.buf.Close()
 				w.completeChunk(cnk.id)
-				blog.V(2).Infof("skipping chunk %d", cnk.id)
+				w.partDone(cnk.id)
+				w.v(2).Infof("skipping chunk %d", cnk.id)
 				continue
 			}
-			blog.V(2).Infof("thread %d handling chunk %d", id, cnk.id)
+			w.v(2).Infof("thread %d handling chunk %d", id, cnk.id)
 			r, err := cnk.buf.Reader()
 			if err != nil {
 				w.setErr(err)
+				cnk.buf.Close() // TODO: log error
 				return
 			}
 			mr := &meteredReader{r: r, size: cnk.buf.Len()}
 			w.registerChunk(cnk.id, mr)
-			sleep := time.Millisecond * 15
+			fc, err := w.partURL()
+			if err != nil {
+				w.setErr(err)
+				w.completeChunk(cnk.id)
+				cnk.buf.Close() // TODO: log error
+				return
+			}
+			sleep := w.retryBackoff()
+			limit := w.MaxPartRetries
+			if limit == 0 {
+				limit = w.MaxRetries
+			}
+			var retries int
 		redo:
+			start := time.Now()
 			n, err := fc.uploadPart(w.ctx, mr, cnk.buf.Hash(), cnk.buf.Len(), cnk.id)
 			if n != cnk.buf.Len() || err != nil {
 				if w.o.b.r.reupload(err) {
-					if err := sleepCtx(w.ctx, sleep); err != nil {
-						w.setErr(err)
+					retries++
+					retry, wait := w.shouldRetry(retries, limit, sleep, err)
+					if !retry {
+						w.failRequest(fmt.Errorf("part %d: giving up after %d retries: %v", cnk.id, retries-1, err), start, retries-1)
 						w.completeChunk(cnk.id)
 						cnk.buf.Close() // TODO: log error
+						return
 					}
-					sleep *= 2
-					if sleep > time.Second*15 {
-						sleep = time.Second * 15
+					if err := sleepCtx(w.ctx, wait); err != nil {
+						w.setErr(err)
+						w.completeChunk(cnk.id)
+						cnk.buf.Close() // TODO: log error
+						return
 					}
-					blog.V(1).Infof("b2 writer: wrote %d of %d: error: %v; retrying", n, cnk.buf.Len(), err)
-					f, err := w.file.getUploadPartURL(w.ctx)
+					sleep = w.nextBackoff(sleep)
+					w.v(1).Infof("b2 writer: wrote %d of %d: error: %v; retrying", n, cnk.buf.Len(), err)
+					f, err := w.partURL()
 					if err != nil {
 						w.setErr(err)
 						w.completeChunk(cnk.id)
@@ -207,14 +649,20 @@ func (w *Writer) thread() {
 					fc = f
 					goto redo
 				}
-				w.setErr(err)
+				w.failRequest(err, start, retries)
 				w.completeChunk(cnk.id)
 				cnk.buf.Close() // TODO: log error
 				return
 			}
+			w.putPartURL(fc)
+			w.recordThroughput(int64(n), time.Since(start))
+			sha, size := partStats(cnk.buf)
+			w.partSent(cnk.id, sha, size)
+			w.progress(int64(size), -1)
 			w.completeChunk(cnk.id)
 			cnk.buf.Close() // TODO: log error
-			blog.V(2).Infof("chunk %d handled", cnk.id)
+			w.partDone(cnk.id)
+			w.v(2).Infof("chunk %d handled", cnk.id)
 		}
 	}()
 }
@@ -222,6 +670,8 @@ func (w *Writer) thread() {
 func (w *Writer) init() {
 	w.start.Do(func() {
 		w.everStarted = true
+		w.began = time.Now()
+		w.resumable = w.Resume
 		w.smux.Lock()
 		w.smap = make(map[int]*meteredReader)
 		w.smux.Unlock()
@@ -230,8 +680,22 @@ func (w *Writer) init() {
 		if w.csize == 0 {
 			w.csize = 1e8
 		}
+		if w.ComputeCRC32C {
+			w.crc = crc32.New(castagnoli)
+		}
+		w.checkClockSkew()
 		if w.newBuffer == nil {
-			w.newBuffer = func() (writeBuffer, error) { return newMemoryBuffer(), nil }
+			w.newBuffer = func() (writeBuffer, error) {
+				mb := newMemoryBuffer()
+				if w.sha1 != "" {
+					mb = newLazyMemoryBuffer()
+				}
+				mb.account = w.accountMemory
+				if n := w.bufferHint(); n > 0 {
+					mb.grow(n)
+				}
+				return mb, nil
+			}
 			if w.UseFileBuffer {
 				w.newBuffer = func() (writeBuffer, error) { return newFileBuffer(w.FileBufferDir) }
 			}
@@ -242,10 +706,50 @@ func (w *Writer) init() {
 			return
 		}
 		w.w = v
+		if w.sha1 != "" && !validSHA1(w.sha1) {
+			// Nothing has been sent, so there is nothing for setErr to cancel.
+			w.emux.Lock()
+			if w.err == nil {
+				w.err = fmt.Errorf("b2: %s: WithSHA1: %q is not a hex-encoded SHA1", w.name, w.sha1)
+			}
+			w.emux.Unlock()
+		}
 	})
 }
 
-// Write satisfies the io.Writer interface.
+// bufferHint returns the capacity to give a new memory buffer, or 0 if the
+// writer has no size to go on.
+func (w *Writer) bufferHint() int {
+	if w.ExpectedSize <= 0 {
+		return 0
+	}
+	if w.ExpectedSize < int64(w.csize) {
+		return int(w.ExpectedSize)
+	}
+	return w.csize
+}
+
+func (w *Writer) accountMemory(n int64) {
+	w.mmux.Lock()
+	w.mem += n
+	w.mmux.Unlock()
+	w.o.b.c.accountMemory(n)
+}
+
+// MemoryInUse returns the number of bytes currently held in memory by this
+// Writer, including the chunk being written and chunks that are waiting to be
+// or are being uploaded.  Writers that use file buffers, or that stream
+// directly from an io.ReadSeeker via ReadFrom, use little memory and are not
+// counted.
+func (w *Writer) MemoryInUse() int64 {
+	w.mmux.Lock()
+	defer w.mmux.Unlock()
+	return w.mem
+}
+
+// Write satisfies the io.Writer interface.  If Write fails part way through p,
+// the count it returns includes every byte that was buffered for upload before
+// the failure, even if the chunk holding them was never sent.
 func (w *Writer) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
@@ -254,11 +758,14 @@ func (w *Writer) Write(p []byte) (int, error) {
 	if err := w.getErr(); err != nil {
 		return 0, err
 	}
+	if w.UseWriteTimeAsModified {
+		w.lastWrite = time.Now()
+	}
 	left := w.csize - w.w.Len()
 	if len(p) < left {
-		return w.w.Write(p)
+		return w.bufWrite(p)
 	}
-	i, err := w.w.Write(p[:left])
+	i, err := w.bufWrite(p[:left])
 	if err != nil {
 		w.setErr(err)
 		return i, err
@@ -274,6 +781,117 @@ func (w *Writer) Write(p []byte) (int, error) {
 	return i + k, err
 }
 
+// WithSHA1 gives the hex-encoded SHA1 of the whole object, when the caller
+// already knows it.  A file sent in a single request is then uploaded with
+// this SHA1, and the writer does not hash its contents; a large file is
+// started with it as its large_file_sha1, unless one was given in
+// WithAttrsOption.  The writer does not check it against the data: B2 rejects
+// a single-request upload whose SHA1 does not match, but cannot check a large
+// file's.  If sha1 is not 40 hex digits, the first call to Write or Close
+// returns an error.  WithSHA1 must be called before the first call to Write.
+func (w *Writer) WithSHA1(sha1 string) {
+	w.sha1 = sha1
+}
+
+// validSHA1 reports whether s is a hex-encoded SHA1.
+func validSHA1(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Tee causes every byte written to w to also be written to t, for instance to
+// keep a local copy.  An error from t fails the upload, as any other error
+// does.  Tee must be called before the first call to Write.
+func (w *Writer) Tee(t io.Writer) {
+	w.tee = t
+}
+
+// bufWrite writes p to the current buffer, and to the tee, if there is one.
+func (w *Writer) bufWrite(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if terr := w.wrote(p[:n]); terr != nil {
+		return n, terr
+	}
+	return n, err
+}
+
+// wrote records p, which has just been added to the current buffer, in the
+// writer's count, CRC and tee.
+func (w *Writer) wrote(p []byte) error {
+	w.written += int64(len(p))
+	if w.crc != nil {
+		w.crc.Write(p)
+	}
+	if w.tee == nil || len(p) == 0 {
+		return nil
+	}
+	if _, terr := w.tee.Write(p); terr != nil {
+		terr = fmt.Errorf("tee: %v", terr)
+		w.setErr(terr)
+		return terr
+	}
+	return nil
+}
+
+// castagnoli is the CRC-32C table used by ComputeCRC32C.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// setInfo sets an info key for the object.
+func (w *Writer) setInfo(key, val string) {
+	if w.info == nil {
+		w.info = make(map[string]string)
+	}
+	w.info[key] = val
+}
+
+// stampWriteTime saves the time of the last write as the object's last
+// modified time, if UseWriteTimeAsModified is set.
+func (w *Writer) stampWriteTime() {
+	if !w.UseWriteTimeAsModified {
+		return
+	}
+	t := w.lastWrite
+	if t.IsZero() {
+		t = time.Now()
+	}
+	key, unit := w.lmKey, w.lmUnit
+	if key == "" {
+		key = "src_last_modified_millis"
+	}
+	if unit <= 0 {
+		unit = time.Millisecond
+	}
+	if _, ok := w.info[key]; !ok && len(w.info) >= 10 {
+		w.v(1).Infof("b2 writer: %s: no room in file info for %s", w.name, key)
+		return
+	}
+	w.setInfo(key, fmt.Sprintf("%d", t.UnixNano()/int64(unit)))
+}
+
+// hashSource computes, in one pass over the source of ReadFrom, the checksums
+// that must be in the object's info before it is uploaded.
+func (w *Writer) hashSource(ra io.ReaderAt, size int64) error {
+	needSHA1 := w.LargeFileSHA1 && size >= int64(w.csize) && w.info["large_file_sha1"] == ""
+	needCRC := w.ComputeCRC32C && w.info["crc32c"] == ""
+	if !needSHA1 && !needCRC {
+		return nil
+	}
+	sh, crc := sha1.New(), crc32.New(castagnoli)
+	if _, err := io.Copy(io.MultiWriter(sh, crc), io.NewSectionReader(ra, 0, size)); err != nil {
+		return err
+	}
+	if needSHA1 {
+		w.setInfo("large_file_sha1", fmt.Sprintf("%x", sh.Sum(nil)))
+	}
+	if needCRC {
+		w.setInfo("crc32c", fmt.Sprintf("%08x", crc.Sum32()))
+	}
+	return nil
+}
+
 func (w *Writer) getUploadURL(ctx context.Context) (beURLInterface, error) {
 	u := w.o.b.urlPool.get()
 	if u == nil {
@@ -284,6 +902,11 @@ func (w *Writer) getUploadURL(ctx context.Context) (beURLInterface, error) {
 }
 
 func (w *Writer) simpleWriteFile() error {
+	// A pooled upload URL needs no request, so check the context here.
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	w.stampWriteTime()
 	ue, err := w.getUploadURL(w.ctx)
 	if err != nil {
 		return err
@@ -291,10 +914,16 @@ func (w *Writer) simpleWriteFile() error {
 	// This defer needs to be in a func() so that we put whatever the value of ue
 	// is at function exit.
 	defer func() { w.o.b.urlPool.put(ue) }()
-	sha1 := w.w.Hash()
-	ctype := w.contentType
-	if ctype == "" {
-		ctype = "application/octet-stream"
+	sha1 := w.sha1
+	if sha1 == "" {
+		sha1 = w.w.Hash()
+	}
+	if w.crc != nil && w.info["crc32c"] == "" {
+		w.setInfo("crc32c", fmt.Sprintf("%08x", w.crc.Sum32()))
+	}
+	ctype := w.resolveContentType()
+	if ok, err := w.dedupCopy(sha1, ctype); err != nil || ok {
+		return err
 	}
 	r, err := w.w.Reader()
 	if err != nil {
@@ -303,61 +932,150 @@ func (w *Writer) simpleWriteFile() error {
 	mr := &meteredReader{r: r, size: w.w.Len()}
 	w.registerChunk(1, mr)
 	defer w.completeChunk(1)
+	sleep := w.retryBackoff()
+	var retries int
 redo:
+	start := time.Now()
 	f, err := ue.uploadFile(w.ctx, mr, int(w.w.Len()), w.name, ctype, sha1, w.info)
 	if err != nil {
 		if w.o.b.r.reupload(err) {
-			blog.V(2).Infof("b2 writer: %v; retrying", err)
+			retry, wait := w.shouldRetry(retries+1, w.MaxRetries, sleep, err)
+			if !retry {
+				err = fmt.Errorf("%s: giving up after %d retries: %v", w.name, retries, err)
+				w.failRequest(err, start, retries)
+				return err
+			}
+			if err := sleepCtx(w.ctx, wait); err != nil {
+				return err
+			}
+			sleep = w.nextBackoff(sleep)
+			w.v(2).Infof("b2 writer: %v; retrying", err)
 			u, err := w.o.b.b.getUploadURL(w.ctx)
 			if err != nil {
 				return err
 			}
 			ue = u
+			retries++
 			goto redo
 		}
+		w.failRequest(err, start, retries)
 		return err
 	}
 	w.o.f = f
+	w.progress(int64(w.w.Len()), int64(w.w.Len()))
+	w.partDone(1)
+	w.dedupAdd(sha1)
 	return nil
 }
 
+// resolveContentType returns the content type to upload with.  Unless the
+// caller gave one, it is looked up by the name's extension, first in the
+// bucket's ContentTypeByExt and then in the mime package.
+func (w *Writer) resolveContentType() string {
+	if w.contentType != "" {
+		return w.contentType
+	}
+	if ext := path.Ext(w.name); ext != "" {
+		if ctype, ok := w.o.b.ContentTypeByExt[ext]; ok {
+			return ctype
+		}
+		if ctype := mime.TypeByExtension(ext); ctype != "" {
+			return ctype
+		}
+	}
+	return "application/octet-stream"
+}
+
 func (w *Writer) getLargeFile() (beLargeFileInterface, error) {
 	if !w.Resume {
-		ctype := w.contentType
-		if ctype == "" {
-			ctype = "application/octet-stream"
+		if w.sha1 != "" && w.info["large_file_sha1"] == "" {
+			w.setInfo("large_file_sha1", w.sha1)
 		}
+		if w.LargeFileSHA1 && w.info["large_file_sha1"] == "" {
+			w.v(1).Infof("b2 writer: %s: SHA1 not known before the first part; uploading without large_file_sha1", w.name)
+		}
+		if w.ComputeCRC32C && w.info["crc32c"] == "" {
+			w.v(1).Infof("b2 writer: %s: CRC-32C not known before the first part; uploading without crc32c", w.name)
+		}
+		w.stampWriteTime()
+		ctype := w.resolveContentType()
 		return w.o.b.b.startLargeFile(w.ctx, w.name, ctype, w.info)
 	}
-	var got bool
-	iter := w.o.b.List(w.ctx, ListPrefix(w.name), ListUnfinished())
-	var fi beFileInterface
-	for iter.Next() {
-		obj := iter.Object()
-		if obj.Name() == w.name {
-			got = true
-			fi = obj.f
-		}
+	obj, err := w.resumeTarget()
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		w.Resume = false
+		return w.getLargeFile()
 	}
-	if iter.Err() != nil {
-		return nil, iter.Err()
+	fi := obj.f
+	seen, sizes, size, err := listSeenParts(w.ctx, fi)
+	if err != nil {
+		return nil, err
 	}
-	if !got {
+	if err := checkPartSizes(sizes); err != nil {
+		if !w.RestartOnInvalidParts || w.ExpectResumeFileID != "" {
+			return nil, fmt.Errorf("resume %s: unfinished large file %s: %v; cancel it, or set RestartOnInvalidParts to start afresh", w.name, fi.id(), err)
+		}
+		w.v(1).Infof("b2 writer: %s: unfinished large file %s: %v; starting over", w.name, fi.id(), err)
+		if err := fi.compileParts(0, nil).cancel(w.ctx); err != nil {
+			return nil, err
+		}
 		w.Resume = false
 		return w.getLargeFile()
 	}
+	if err := w.checkTokenParts(seen); err != nil {
+		return nil, err
+	}
+	w.seen = make(map[int]string) // copy the map
+	for id, sha := range seen {
+		w.seen[id] = sha
+	}
+	return fi.compileParts(size, seen), nil
+}
+
+// resumeTarget returns the unfinished large file that the writer should
+// resume, or nil if it should start a new one.
+func (w *Writer) resumeTarget() (*Object, error) {
+	objs, err := w.o.b.UnfinishedLargeFiles(w.ctx, w.name)
+	if err != nil {
+		return nil, err
+	}
+	var obj *Object
+	if len(objs) > 0 {
+		obj = objs[len(objs)-1]
+		if w.ResumeSelector != nil {
+			obj = w.ResumeSelector(objs)
+		}
+	}
+	if w.ExpectResumeFileID != "" {
+		if obj == nil {
+			return nil, fmt.Errorf("resume %s: no unfinished large file, want ID %s", w.name, w.ExpectResumeFileID)
+		}
+		if id := obj.f.id(); id != w.ExpectResumeFileID {
+			return nil, fmt.Errorf("resume %s: found file ID %s, want %s", w.name, id, w.ExpectResumeFileID)
+		}
+	}
+	return obj, nil
+}
 
+// listSeenParts returns the SHA1 of every part that B2 holds of the given
+// unfinished large file, and their total size.
+func listSeenParts(ctx context.Context, fi beFileInterface) (map[int]string, map[int]int64, int64, error) {
 	next := 1
 	seen := make(map[int]string)
+	sizes := make(map[int]int64)
 	var size int64
 	for {
-		parts, n, err := fi.listParts(w.ctx, next, 100)
+		parts, n, err := fi.listParts(ctx, next, 100)
 		if err != nil {
-			return nil, err
+			return nil, nil, 0, err
 		}
 		next = n
 		for _, p := range parts {
 			seen[p.number()] = p.sha1()
+			sizes[p.number()] = p.size()
 			size += p.size()
 		}
 		if len(parts) == 0 {
@@ -367,14 +1085,218 @@ func (w *Writer) getLargeFile() (beLargeFileInterface, error) {
 			break
 		}
 	}
-	w.seen = make(map[int]string) // copy the map
+	return seen, sizes, size, nil
+}
+
+// minPartSize is the smallest that B2 allows any but the last part of a large
+// file to be.
+const minPartSize = 5e6
+
+// checkPartSizes reports a part, other than the highest numbered, that is
+// too small for B2 to finish the file.  Only a buggy uploader leaves such a
+// part, but B2 accepts it, and the problem appears only when the file is
+// finished.
+func checkPartSizes(sizes map[int]int64) error {
+	last := 0
+	for id := range sizes {
+		if id > last {
+			last = id
+		}
+	}
+	var bad []int
+	for id, size := range sizes {
+		if id != last && size < minPartSize {
+			bad = append(bad, id)
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	sort.Ints(bad)
+	return fmt.Errorf("part %d is %d bytes, less than the %d B2 requires of every part but the last", bad[0], sizes[bad[0]], int64(minPartSize))
+}
+
+// restartOnMismatch compares the parts B2 holds of the large file that the
+// writer would resume with the corresponding parts of rs.  If any differ, it
+// cancels that large file, so that the writer starts afresh.
+func (w *Writer) restartOnMismatch(rs io.ReadSeeker, size int64) error {
+	if w.PartNumbers != nil {
+		return nil
+	}
+	obj, err := w.resumeTarget()
+	if err != nil || obj == nil {
+		return err
+	}
+	seen, _, _, err := listSeenParts(w.ctx, obj.f)
+	if err != nil {
+		return err
+	}
+	first := w.FirstPart
+	if first < 1 {
+		first = 1
+	}
+	csize := int64(w.ChunkSize)
+	if csize == 0 {
+		csize = 1e8 // as in init
+	}
+	ra := enReaderAt(rs)
+	var mismatch bool
 	for id, sha := range seen {
-		w.seen[id] = sha
+		off := int64(id-first) * csize
+		if off < 0 || off >= size {
+			mismatch = true
+			break
+		}
+		h := sha1.New()
+		if _, err := io.Copy(h, io.NewSectionReader(ra, off, csize)); err != nil {
+			return err
+		}
+		if fmt.Sprintf("%x", h.Sum(nil)) != sha {
+			mismatch = true
+			break
+		}
+	}
+	if !mismatch {
+		return nil
+	}
+	if w.ExpectResumeFileID != "" {
+		return fmt.Errorf("resume %s: file ID %s does not match the source; not restarting because ExpectResumeFileID is set", w.name, w.ExpectResumeFileID)
+	}
+	w.v(1).Infof("b2 writer: %s: source differs from unfinished large file %s; starting over", w.name, obj.f.id())
+	if err := obj.f.compileParts(0, nil).cancel(w.ctx); err != nil {
+		return err
+	}
+	w.Resume = false
+	return nil
+}
+
+func (w *Writer) recordHash(id int, sha string) {
+	if !w.VerifyResumedParts || w.seen == nil {
+		return
+	}
+	w.hmux.Lock()
+	defer w.hmux.Unlock()
+	if w.hashes == nil {
+		w.hashes = make(map[int]string)
+	}
+	w.hashes[id] = sha
+}
+
+func (w *Writer) notePart(id int) {
+	w.hmux.Lock()
+	defer w.hmux.Unlock()
+	if w.partIDs == nil {
+		w.partIDs = make(map[int]bool)
+	}
+	w.partIDs[id] = true
+}
+
+func (w *Writer) partSent(id int, sha string, size int) {
+	w.hmux.Lock()
+	defer w.hmux.Unlock()
+	if w.sent == nil {
+		w.sent = make(map[int]string)
+		w.sizes = make(map[int]int)
+	}
+	w.sent[id] = sha
+	w.sizes[id] = size
+}
+
+// nextPart returns the number of the next part to be sent.
+func (w *Writer) nextPart() int {
+	if w.PartNumbers != nil {
+		return w.PartNumbers()
+	}
+	first := w.FirstPart
+	if first < 1 {
+		first = 1
+	}
+	return first + w.cidx
+}
+
+// checkContiguous verifies that the parts of the large file, both those that
+// already existed and those this writer sent, are numbered 1 through N.
+func (w *Writer) checkContiguous() error {
+	w.hmux.Lock()
+	defer w.hmux.Unlock()
+	ids := make(map[int]bool)
+	for id := range w.seen {
+		ids[id] = true
+	}
+	for id := range w.partIDs {
+		ids[id] = true
+	}
+	for i := 1; i <= len(ids); i++ {
+		if !ids[i] {
+			return fmt.Errorf("large file %s: parts are not contiguous: missing part %d of %d", w.name, i, len(ids))
+		}
+	}
+	return nil
+}
+
+func (w *Writer) verifyResumedParts() error {
+	if !w.VerifyResumedParts || w.seen == nil {
+		return nil
+	}
+	w.hmux.Lock()
+	defer w.hmux.Unlock()
+	for id, sha := range w.seen {
+		want, ok := w.hashes[id]
+		if !ok {
+			return fmt.Errorf("resumed upload: B2 holds part %d, which this upload did not produce", id)
+		}
+		if sha != want {
+			return fmt.Errorf("resumed upload: part %d: B2 has SHA1 %s, want %s", id, sha, want)
+		}
+	}
+	return nil
+}
+
+// Pause stops the writer from sending any more data to B2 until Unpause is
+// called.  Parts already being uploaded are finished.  While the writer is
+// paused, a Write that would begin a new part blocks, as does Close; either
+// returns early with an error if the writer's context is cancelled.  Pause
+// and Unpause may be called from any goroutine, and pausing a paused writer
+// does nothing.
+func (w *Writer) Pause() {
+	w.pamux.Lock()
+	defer w.pamux.Unlock()
+	if w.paused == nil {
+		w.paused = make(chan struct{})
+	}
+}
+
+// Unpause lets a writer stopped by Pause continue.
+func (w *Writer) Unpause() {
+	w.pamux.Lock()
+	defer w.pamux.Unlock()
+	if w.paused != nil {
+		close(w.paused)
+		w.paused = nil
+	}
+}
+
+// waitUnpaused blocks while the writer is paused.
+func (w *Writer) waitUnpaused() error {
+	w.pamux.Lock()
+	ch := w.paused
+	w.pamux.Unlock()
+	if ch == nil {
+		return nil
+	}
+	w.v(2).Infof("b2 writer: %s: paused", w.name)
+	select {
+	case <-ch:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
 	}
-	return fi.compileParts(size, seen), nil
 }
 
 func (w *Writer) sendChunk() error {
+	if err := w.waitUnpaused(); err != nil {
+		return err
+	}
 	var err error
 	w.once.Do(func() {
 		lf, e := w.getLargeFile()
@@ -388,6 +1310,14 @@ func (w *Writer) sendChunk() error {
 		if w.ConcurrentUploads < 1 {
 			w.ConcurrentUploads = 1
 		}
+		if w.WarmUploadURLs {
+			fcs, e := w.warmUploadURLs(w.ConcurrentUploads)
+			if e != nil {
+				err = e
+				return
+			}
+			w.partURLs = fcs
+		}
 		for i := 0; i < w.ConcurrentUploads; i++ {
 			w.thread()
 		}
@@ -395,17 +1325,27 @@ func (w *Writer) sendChunk() error {
 	if err != nil {
 		return err
 	}
+	id := w.nextPart()
+	if w.dispatched[id] {
+		// B2 would keep whichever copy of the part arrived last.
+		return fmt.Errorf("b2: %s: part %d dispatched twice", w.name, id)
+	}
 	select {
 	case <-w.cdone:
 		return nil
 	case w.ready <- chunk{
-		id:  w.cidx + 1,
+		id:  id,
 		buf: w.w,
 	}:
 	case <-w.ctx.Done():
 		return w.ctx.Err()
 	}
+	if w.dispatched == nil {
+		w.dispatched = make(map[int]bool)
+	}
+	w.dispatched[id] = true
 	w.cidx++
+	w.adaptChunkSize()
 	v, err := w.newBuffer()
 	if err != nil {
 		return err
@@ -414,9 +1354,179 @@ func (w *Writer) sendChunk() error {
 	return nil
 }
 
+// shouldRetry reports whether to retry an upload whose attempt'th try failed
+// with err, and how long to wait first.  The client's RetryPolicy decides, if
+// it has one; otherwise the writer gives up after limit retries, if limit is
+// positive, and waits sleep.
+func (w *Writer) shouldRetry(attempt, limit int, sleep time.Duration, err error) (bool, time.Duration) {
+	if p := w.o.b.r.retryPolicy(); p != nil {
+		retry, wait := p.ShouldRetry(attempt, err)
+		return retry, w.retryWait(wait, err)
+	}
+	if limit > 0 && attempt > limit {
+		return false, 0
+	}
+	return true, w.retryWait(w.o.b.r.jitter(sleep), err)
+}
+
+// retryWait returns how long to wait before retrying after err: the
+// writer's backoff, or longer if B2 asked for it with Retry-After.
+func (w *Writer) retryWait(backoff time.Duration, err error) time.Duration {
+	if d := w.o.b.r.backoff(err); d > backoff {
+		return d
+	}
+	return backoff
+}
+
+// testAdaptiveFloor, if positive, replaces minPartSize as the smallest part
+// AdaptiveChunkSizing will choose, so that tests can work with small parts.
+var testAdaptiveFloor int
+
+// retryBackoff returns the wait before the writer's first retry of an upload.
+func (w *Writer) retryBackoff() time.Duration {
+	if w.RetryBackoff > 0 {
+		return w.RetryBackoff
+	}
+	return 15 * time.Millisecond
+}
+
+// nextBackoff returns the wait after one of d, doubled and capped at
+// MaxBackoff.
+func (w *Writer) nextBackoff(d time.Duration) time.Duration {
+	max := w.MaxBackoff
+	if max <= 0 {
+		max = 15 * time.Second
+	}
+	d *= 2
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// progress records that n more bytes have reached B2, and reports the new
+// count to ProgressFunc.
+func (w *Writer) progress(n, total int64) {
+	if w.ProgressFunc == nil {
+		return
+	}
+	w.prmux.Lock()
+	defer w.prmux.Unlock()
+	w.uploaded += n
+	w.ProgressFunc(w.uploaded, total)
+}
+
+// uploadedBytes returns the number of bytes reported to ProgressFunc.
+func (w *Writer) uploadedBytes() int64 {
+	w.prmux.Lock()
+	defer w.prmux.Unlock()
+	return w.uploaded
+}
+
+func (w *Writer) recordThroughput(n int64, d time.Duration) {
+	w.tmux.Lock()
+	defer w.tmux.Unlock()
+	w.tbytes += n
+	w.tdur += d
+}
+
+// throughput returns the observed per-thread upload rate in bytes per second,
+// or zero if no parts have been sent.
+func (w *Writer) throughput() float64 {
+	w.tmux.Lock()
+	defer w.tmux.Unlock()
+	if w.tdur <= 0 {
+		return 0
+	}
+	return float64(w.tbytes) / w.tdur.Seconds()
+}
+
+func (w *Writer) adaptChunkSize() {
+	if !w.AdaptiveChunkSizing {
+		return
+	}
+	deadline, ok := w.ctx.Deadline()
+	if !ok {
+		return
+	}
+	rate := w.throughput()
+	if rate == 0 {
+		return
+	}
+	// Aim for a part to take at most half the remaining time, to leave room for
+	// retries and for parts already queued ahead of it.
+	size := int(rate * time.Until(deadline).Seconds() / 2)
+	floor := testAdaptiveFloor
+	if floor <= 0 {
+		floor = minPartSize
+	}
+	if size < floor {
+		size = floor
+	}
+	if size >= w.csize {
+		return
+	}
+	w.v(2).Infof("b2 writer: %s: reducing chunk size from %d to %d", w.name, w.csize, size)
+	w.csize = size
+	w.resized = true
+}
+
+// chunkFiller writes into the writer's current buffer, as Write does, but
+// without sending full chunks.
+type chunkFiller struct{ w *Writer }
+
+func (c chunkFiller) Write(p []byte) (int, error) { return c.w.bufWrite(p) }
+
+// bufFill reads up to n bytes from r into the writer's current buffer, as
+// bufWrite would add them.  Memory buffers are read into directly; others are
+// copied to through chunkFiller.  It returns io.EOF if r ends first.
+func (w *Writer) bufFill(r io.Reader, n int64) (int64, error) {
+	mb, ok := w.w.(*memoryBuffer)
+	if !ok {
+		return io.CopyN(chunkFiller{w}, r, n)
+	}
+	p, err := mb.fill(r, int(n))
+	if terr := w.wrote(p); terr != nil {
+		return int64(len(p)), terr
+	}
+	return int64(len(p)), err
+}
+
+// readChunks reads r into the writer a chunk at a time, filling each buffer
+// straight from r and sending it when it is full.
+func (w *Writer) readChunks(r io.Reader) (int64, error) {
+	w.init()
+	var n int64
+	for {
+		if err := w.getErr(); err != nil {
+			return n, err
+		}
+		left := int64(w.csize - w.w.Len())
+		k, err := w.bufFill(r, left)
+		n += k
+		if werr := w.getErr(); werr != nil {
+			return n, werr
+		}
+		if k == left {
+			if err := w.sendChunk(); err != nil {
+				w.setErr(err)
+				return n, w.getErr()
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
 // ReadFrom reads all of r into w, returning the first error or no error if r
 // returns io.EOF.  If r is also an io.Seeker, ReadFrom will stream r directly
 // over the wire instead of buffering it locally.  This reduces memory usage.
+// Otherwise, ReadFrom fills each chunk's buffer straight from r, rather than
+// passing the data through Write.
 //
 // Do not issue multiple calls to ReadFrom, or mix ReadFrom and Write.  If you
 // have multiple readers you want to concatenate into the same B2 object, use
@@ -424,14 +1534,26 @@ func (w *Writer) sendChunk() error {
 //
 // Note that io.Copy will automatically choose to use ReadFrom.
 //
-// ReadFrom currently doesn't handle w.Resume; if w.Resume is true, ReadFrom
-// will act as if r is not an io.Seeker.
+// ReadFrom currently doesn't handle w.Resume or Tee; if either is in use,
+// ReadFrom will act as if r is not an io.Seeker.
 func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
 	rs, ok := r.(io.ReadSeeker)
-	if !ok || w.Resume {
-		return copyContext(w.ctx, w, r)
+	if ok && w.Resume && w.RestartOnResumeMismatch {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if err := w.restartOnMismatch(rs, size); err != nil {
+			return 0, err
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	if !ok || w.Resume || w.tee != nil {
+		return runContext(w.ctx, func() (int64, error) { return w.readChunks(r) })
 	}
-	blog.V(2).Info("streaming without buffer")
+	w.v(2).Infof("streaming without buffer")
 	size, err := rs.Seek(0, io.SeekEnd)
 	if err != nil {
 		return 0, err
@@ -463,6 +1585,13 @@ func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
 		return nb, nil
 	}
 	w.init()
+	w.written += size
+	if w.UseWriteTimeAsModified {
+		w.lastWrite = time.Now()
+	}
+	if err := w.hashSource(ra, size); err != nil {
+		return 0, err
+	}
 	if size < int64(w.csize) {
 		// the magic happens on w.Close()
 		return size, nil
@@ -481,20 +1610,59 @@ func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
 // value of Close for all writers.
 func (w *Writer) Close() error {
 	w.done.Do(func() {
+		defer w.closeParts()
+		defer w.runAfterClose()
 		if !w.everStarted {
+			if w.LeaveUnfinished {
+				return
+			}
 			w.init()
+			if w.getErr() != nil {
+				return
+			}
+			if err := w.waitUnpaused(); err != nil {
+				w.setErr(err)
+				return
+			}
 			w.setErr(w.simpleWriteFile())
+			w.deleteOlder()
 			return
 		}
 		defer w.o.b.c.removeWriter(w)
+		if w.w == nil {
+			// init could not make a buffer, and has set the error.
+			return
+		}
 		defer func() {
 			if err := w.w.Close(); err != nil {
 				// this is non-fatal, but alarming
-				blog.V(1).Infof("close %s: %v", w.name, err)
+				w.v(1).Infof("close %s: %v", w.name, err)
 			}
 		}()
-		if w.cidx == 0 {
+		var partsDone, finished bool
+		defer func() {
+			if w.file == nil || finished {
+				return
+			}
+			if !partsDone {
+				// Stop the part uploaders, which would otherwise wait forever.
+				close(w.cdone)
+				w.wg.Wait()
+			}
+			if w.abandoned() {
+				w.cancelLargeFile()
+			}
+		}()
+		if w.cidx == 0 && !w.LeaveUnfinished {
+			if w.getErr() != nil {
+				return
+			}
+			if err := w.waitUnpaused(); err != nil {
+				w.setErr(err)
+				return
+			}
 			w.setErr(w.simpleWriteFile())
+			w.deleteOlder()
 			return
 		}
 		if w.w.Len() > 0 {
@@ -503,20 +1671,273 @@ func (w *Writer) Close() error {
 				return
 			}
 		}
+		if w.file == nil {
+			// LeaveUnfinished, but nothing was written.
+			return
+		}
 		// See https://github.com/kurin/blazer/issues/60 for why we use a special
 		// channel for this.
 		close(w.cdone)
 		w.wg.Wait()
+		partsDone = true
+		if err := w.ctx.Err(); err != nil {
+			// Parts may have been sent after ctx was cancelled, but the file
+			// is not finished.
+			w.setErr(err)
+			return
+		}
+		if w.LeaveUnfinished {
+			return
+		}
+		if err := w.verifyResumedParts(); err != nil {
+			w.setErr(err)
+			return
+		}
+		if err := w.checkContiguous(); err != nil {
+			w.setErr(err)
+			return
+		}
 		f, err := w.file.finishLargeFile(w.ctx)
 		if err != nil {
 			w.setErr(err)
 			return
 		}
+		finished = true
+		w.emux.Lock()
+		w.fileDone = true
+		w.emux.Unlock()
 		w.o.f = f
+		w.progress(0, w.uploadedBytes())
+		w.deleteOlder()
+		if w.WriteManifest {
+			if err := w.writeManifest(); err != nil {
+				// The large file is finished, so there is nothing to cancel.
+				w.emux.Lock()
+				w.err = err
+				w.emux.Unlock()
+			}
+		}
 	})
 	return w.getErr()
 }
 
+// deleteOlder deletes the versions of the object older than the one the
+// writer uploaded, if DeleteOlderVersionsOnClose is set and the upload
+// succeeded.
+func (w *Writer) deleteOlder() {
+	if !w.DeleteOlderVersionsOnClose || w.getErr() != nil {
+		return
+	}
+	if err := w.o.deleteOlderVersions(w.ctx); err != nil {
+		// The upload itself is over, so there is nothing to cancel.
+		w.emux.Lock()
+		w.err = err
+		w.emux.Unlock()
+	}
+}
+
+// errWriterStopped is given to afterClose when the writer is stopped without
+// being closed.
+var errWriterStopped = errors.New("b2: writer stopped before Close")
+
+// stopAfterClose runs afterClose for a writer that was stopped rather than
+// closed, so that it can clean up.
+func (w *Writer) stopAfterClose() {
+	if w.afterClose == nil {
+		return
+	}
+	if err := w.afterClose(errWriterStopped); err != nil && err != errWriterStopped {
+		w.v(1).Infof("b2 writer: %s: after stopping: %v", w.name, err)
+	}
+}
+
+func (w *Writer) runAfterClose() {
+	if w.afterClose == nil {
+		return
+	}
+	err := w.afterClose(w.getErr())
+	if err == nil {
+		return
+	}
+	// The upload itself is over, so there is nothing to cancel.
+	w.emux.Lock()
+	defer w.emux.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// UploadSummary reports, after Close, how the object was uploaded: whether as a
+// large file, in how many parts (one, for a file that is not large), and how
+// many bytes were written to it.  Parts of a resumed large file that B2
+// already held are counted.
+func (w *Writer) UploadSummary() (parts int, large bool, bytes int64) {
+	if w.file != nil {
+		return w.cidx, true, w.written
+	}
+	return 1, false, w.written
+}
+
+// CloseAndObject closes the writer, as Close does, and returns the object that
+// was written.  If Close returns an error, the object is nil.
+func (w *Writer) CloseAndObject() (*Object, error) {
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return w.o, nil
+}
+
+// UploadReader writes all of r to the named object, and returns the object.
+// Files smaller than the writer's ChunkSize are sent in a single request;
+// larger files are sent as large files.  If the upload fails, including
+// because ctx is cancelled, any large file that was started is cancelled.
+func (b *Bucket) UploadReader(ctx context.Context, name string, r io.Reader, opts ...WriterOption) (*Object, error) {
+	w := b.Object(name).NewWriter(ctx, opts...)
+	if err := w.readAll(r); err != nil {
+		w.abort()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w.o, nil
+}
+
+// stdin is read by UploadStdin.
+var stdin io.Reader = os.Stdin
+
+// UploadStdin writes the process's standard input, until EOF, to the named
+// object, as UploadReader does.  Input of unknown length is split into
+// ChunkSize parts, with whatever remains sent as the last, shorter part.
+// Cancelling ctx abandons the upload once the pending read of standard input
+// returns.
+func (b *Bucket) UploadStdin(ctx context.Context, name string, opts ...WriterOption) (*Object, error) {
+	// Hide Seek: standard input is an *os.File, but is seldom seekable.
+	return b.UploadReader(ctx, name, struct{ io.Reader }{stdin}, opts...)
+}
+
+// readAll writes r to the writer.  Unlike ReadFrom, it never leaves a
+// goroutine writing after it returns, so the writer may be safely aborted.
+func (w *Writer) readAll(r io.Reader) error {
+	if _, ok := r.(io.ReadSeeker); ok && !w.Resume && w.tee == nil {
+		_, err := w.ReadFrom(r)
+		return err
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// abort stops the writer without uploading anything buffered, and cancels any
+// large file it started.
+func (w *Writer) abort() {
+	w.stop()
+	w.cancelLargeFile()
+}
+
+// Cancel stops the writer without uploading anything buffered, and cancels the
+// large file it started, if any, so that the parts already sent no longer take
+// up space.  It returns the error from cancelling the large file.  A writer
+// that has been cancelled cannot be used again, and Close returns an error.
+//
+// Cancel may be called after Close, to clean up a large file that Close left
+// unfinished, such as with LeaveUnfinished or Resume; it does nothing if the
+// object was written.
+func (w *Writer) Cancel(ctx context.Context) error {
+	if w.stop() {
+		w.emux.Lock()
+		if w.err == nil {
+			w.err = errors.New("b2: writer cancelled")
+		}
+		w.emux.Unlock()
+	}
+	return w.cancelFile(ctx)
+}
+
+// stop stops the writer without uploading anything buffered, and waits for
+// any part uploads to return.  It reports whether the writer was still open.
+func (w *Writer) stop() bool {
+	w.cancel()
+	var stopped bool
+	w.done.Do(func() {
+		stopped = true
+		defer w.closeParts()
+		defer w.stopAfterClose()
+		if !w.everStarted {
+			return
+		}
+		defer w.o.b.c.removeWriter(w)
+		if w.w != nil {
+			if err := w.w.Close(); err != nil {
+				w.v(1).Infof("close %s: %v", w.name, err)
+			}
+		}
+		if w.file != nil {
+			close(w.cdone)
+			w.wg.Wait()
+		}
+	})
+	return stopped
+}
+
+// abandoned reports whether the writer's large file was left unfinished,
+// because of an error or because the caller's context was cancelled, and
+// should be cancelled rather than left to take up space.  A writer that
+// resumes or leaves files unfinished keeps them, as does one with
+// WithCancelOnError, which has already dealt with the file.
+func (w *Writer) abandoned() bool {
+	if w.getErr() == nil && (w.parent == nil || w.parent.Err() == nil) {
+		return false
+	}
+	return !w.LeaveUnfinished && !w.resumable && w.ctxf == nil
+}
+
+// cancelLargeFile makes a best-effort attempt to cancel the writer's large
+// file.  It uses a fresh context, since the writer's own may be done.
+func (w *Writer) cancelLargeFile() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := w.cancelFile(ctx); err != nil {
+		w.v(1).Infof("b2 writer: %s: cancelling large file: %v", w.name, err)
+	}
+}
+
+// cancelFile cancels the writer's large file, unless there is none or it is
+// already finished or cancelled.
+func (w *Writer) cancelFile(ctx context.Context) error {
+	// emux is not held across the call to B2, so that getErr and setErr don't
+	// wait on the network.
+	w.emux.Lock()
+	file, done := w.file, w.fileDone
+	w.emux.Unlock()
+	if file == nil || done {
+		return nil
+	}
+	if err := file.cancel(ctx); err != nil {
+		return err
+	}
+	w.emux.Lock()
+	w.fileDone = true
+	w.emux.Unlock()
+	return nil
+}
+
 func (w *Writer) withAttrs(attrs *Attrs) *Writer {
 	w.contentType = attrs.ContentType
 	w.info = make(map[string]string)
@@ -526,8 +1947,18 @@ func (w *Writer) withAttrs(attrs *Attrs) *Writer {
 	if len(w.info) < 10 && attrs.SHA1 != "" {
 		w.info["large_file_sha1"] = attrs.SHA1
 	}
+	w.lmKey, w.lmUnit = attrs.LastModifiedKey, attrs.LastModifiedUnit
 	if len(w.info) < 10 && !attrs.LastModified.IsZero() {
-		w.info["src_last_modified_millis"] = fmt.Sprintf("%d", attrs.LastModified.UnixNano()/1e6)
+		key := attrs.LastModifiedKey
+		if key == "" {
+			key = "src_last_modified_millis"
+		}
+		unit := attrs.LastModifiedUnit
+		if unit <= 0 {
+			unit = time.Millisecond
+		}
+		w.info[key] = fmt.Sprintf("%d", attrs.LastModified.UnixNano()/int64(unit))
+		w.lastModified = attrs.LastModified
 	}
 	return w
 }
@@ -571,8 +2002,13 @@ func (w *Writer) status() *WriterStatus {
 		Progress: make([]float64, len(w.smap)),
 	}
 
-	for i := 1; i <= len(w.smap); i++ {
-		ws.Progress[i-1] = w.smap[i].done()
+	ids := make([]int, 0, len(w.smap))
+	for id := range w.smap {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for i, id := range ids {
+		ws.Progress[i] = w.smap[id].done()
 	}
 
 	return ws
@@ -607,3 +2043,67 @@ func (mr *meteredReader) done() float64 {
 	read := float64(atomic.LoadInt64(&mr.read))
 	return read / float64(mr.size)
 }
+
+type multiWriter struct {
+	ws []*Writer
+}
+
+// MultiWriter returns an io.WriteCloser that duplicates its writes to all the
+// given Writers, so that the same content can be uploaded to several objects
+// (possibly in different buckets) while reading the source only once.  Each
+// Writer still maintains its own buffers.
+//
+// Close closes every Writer concurrently, waits for them all to finish, and
+// returns an error describing every Writer that failed.
+func MultiWriter(writers ...*Writer) io.WriteCloser {
+	ws := make([]*Writer, len(writers))
+	copy(ws, writers)
+	return &multiWriter{ws: ws}
+}
+
+func (mw *multiWriter) Write(p []byte) (int, error) {
+	for _, w := range mw.ws {
+		n, err := w.Write(p)
+		if err != nil {
+			return n, err
+		}
+		if n != len(p) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return len(p), nil
+}
+
+func (mw *multiWriter) Close() error {
+	errs := make([]error, len(mw.ws))
+	wg := &sync.WaitGroup{}
+	for i, w := range mw.ws {
+		wg.Add(1)
+		go func(i int, w *Writer) {
+			defer wg.Done()
+			errs[i] = w.Close()
+		}(i, w)
+	}
+	wg.Wait()
+	var me multiErr
+	for i, err := range errs {
+		if err != nil {
+			me = append(me, fmt.Errorf("%s/%s: %v", mw.ws[i].o.b.Name(), mw.ws[i].name, err))
+		}
+	}
+	if len(me) == 0 {
+		return nil
+	}
+	return me
+}
+
+// multiErr collects the errors from several concurrent operations.
+type multiErr []error
+
+func (me multiErr) Error() string {
+	var s []string
+	for _, err := range me {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
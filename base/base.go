@@ -14,15 +14,12 @@
 
 // Package base provides a very low-level interface on top of the B2 v1 API.
 // It is not intended to be used directly.
-//
-// It currently lacks support for the following APIs:
-//
-// b2_download_file_by_id
 package base
 
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -30,6 +27,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -67,12 +65,14 @@ func Action(err error) ErrAction {
 	if !ok {
 		return Punt
 	}
-	if e.retry > 0 {
-		return Retry
-	}
+	// B2 asks for a new upload URL after a 5xx from an upload, even one that
+	// also gives a Retry-After.
 	if e.code >= 500 && e.code < 600 && (e.method == "b2_upload_file" || e.method == "b2_upload_part") {
 		return AttemptNewUpload
 	}
+	if e.retry > 0 {
+		return Retry
+	}
 	switch e.code {
 	case 401:
 		switch e.method {
@@ -175,7 +175,8 @@ func mkErr(resp *http.Response) error {
 // Backoff returns an appropriate amount of time to wait, given an error, if
 // any was returned by the server.  If the return value is 0, but Action
 // indicates Retry, the user should implement their own exponential backoff,
-// beginning with one second.
+// beginning with one second.  An upload error whose Action is AttemptNewUpload
+// can also carry a wait, which applies before uploading again.
 func Backoff(err error) time.Duration {
 	e, ok := err.(b2err)
 	if !ok {
@@ -278,10 +279,14 @@ type B2 struct {
 	authToken   string
 	apiURI      string
 	downloadURI string
+	s3URI       string
 	minPartSize int
+	raw         map[string]interface{} // the full b2_authorize_account reply
 	opts        *b2Options
 	bucket      string // restricted to this bucket if present
+	bucketName  string // the name of the restricted bucket, if it exists
 	pfx         string // restricted to objects with this prefix if present
+	caps        []string
 }
 
 // Update replaces the B2 object with a new one, in-place.
@@ -290,10 +295,66 @@ func (b *B2) Update(n *B2) {
 	b.authToken = n.authToken
 	b.apiURI = n.apiURI
 	b.downloadURI = n.downloadURI
+	b.s3URI = n.s3URI
 	b.minPartSize = n.minPartSize
+	b.raw = n.raw
+	b.bucket = n.bucket
+	b.bucketName = n.bucketName
+	b.pfx = n.pfx
+	b.caps = n.caps
 	b.opts = n.opts
 }
 
+// PublicBucket returns a Bucket that downloads, without authorization, from
+// the named bucket at downloadURI.  It can be used to download files from
+// public buckets that belong to other accounts; it supports no other
+// operation.
+func (b *B2) PublicBucket(name, downloadURI string) *Bucket {
+	return &Bucket{
+		Name: name,
+		b2: &B2{
+			downloadURI: downloadURI,
+			opts:        b.opts,
+		},
+	}
+}
+
+// AllowedBucket returns the ID and name of the bucket to which the account's
+// key is restricted.  Both are empty if the key is unrestricted.  The name is
+// empty if the bucket has since been deleted.
+func (b *B2) AllowedBucket() (id, name string) {
+	return b.bucket, b.bucketName
+}
+
+// Allowance returns the capabilities of the account's key, and the prefix to
+// which it is restricted, if any.
+func (b *B2) Allowance() (caps []string, prefix string) {
+	return b.caps, b.pfx
+}
+
+// Bucket returns the bucket with the given ID and name, without looking it
+// up.  Only the bucket's ID and name are set.
+func (b *B2) Bucket(id, name string) *Bucket {
+	return &Bucket{
+		Name: name,
+		ID:   id,
+		b2:   b,
+	}
+}
+
+// S3APIURL returns the endpoint of the account's S3-compatible API.  It is
+// empty if the service did not report one.
+func (b *B2) S3APIURL() string {
+	return b.s3URI
+}
+
+// RawAuthInfo returns the b2_authorize_account reply as decoded JSON.  It
+// includes fields this package does not otherwise expose, as well as the
+// account's authorization token.
+func (b *B2) RawAuthInfo() map[string]interface{} {
+	return b.raw
+}
+
 type httpReply struct {
 	resp *http.Response
 	err  error
@@ -436,7 +497,7 @@ func (o *b2Options) makeRequest(ctx context.Context, method, verb, uri string, b
 // AuthorizeAccount wraps b2_authorize_account.
 func AuthorizeAccount(ctx context.Context, account, key string, opts ...AuthOption) (*B2, error) {
 	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", account, key)))
-	b2resp := &b2types.AuthorizeAccountResponse{}
+	var reply json.RawMessage
 	headers := map[string]string{
 		"Authorization": fmt.Sprintf("Basic %s", auth),
 	}
@@ -444,7 +505,15 @@ func AuthorizeAccount(ctx context.Context, account, key string, opts ...AuthOpti
 	for _, f := range opts {
 		f(b2opts)
 	}
-	if err := b2opts.makeRequest(ctx, "b2_authorize_account", "GET", b2opts.getAPIBase()+b2types.V1api+"b2_authorize_account", nil, b2resp, headers, nil); err != nil {
+	if err := b2opts.makeRequest(ctx, "b2_authorize_account", "GET", b2opts.getAPIBase()+b2types.V1api+"b2_authorize_account", nil, &reply, headers, nil); err != nil {
+		return nil, err
+	}
+	b2resp := &b2types.AuthorizeAccountResponse{}
+	if err := json.Unmarshal(reply, b2resp); err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(reply, &raw); err != nil {
 		return nil, err
 	}
 	return &B2{
@@ -452,9 +521,13 @@ func AuthorizeAccount(ctx context.Context, account, key string, opts ...AuthOpti
 		authToken:   b2resp.AuthToken,
 		apiURI:      b2resp.URI,
 		downloadURI: b2resp.DownloadURI,
+		s3URI:       b2resp.S3URI,
 		minPartSize: b2resp.PartSize,
+		raw:         raw,
 		bucket:      b2resp.Allowed.Bucket,
+		bucketName:  b2resp.Allowed.BucketName,
 		pfx:         b2resp.Allowed.Prefix,
+		caps:        b2resp.Allowed.Capabilities,
 		opts:        b2opts,
 	}, nil
 }
@@ -520,6 +593,129 @@ type LifecycleRule struct {
 	DaysHiddenUntilDeleted int
 }
 
+// CORSRule is a single cross-origin resource sharing rule.
+type CORSRule struct {
+	Name              string
+	AllowedOrigins    []string
+	AllowedOperations []string
+	AllowedHeaders    []string
+	ExposeHeaders     []string
+	MaxAgeSeconds     int
+}
+
+func corsFromB2(b2rules []b2types.CORSRule) []CORSRule {
+	var rules []CORSRule
+	for _, rule := range b2rules {
+		rules = append(rules, CORSRule{
+			Name:              rule.Name,
+			AllowedOrigins:    rule.AllowedOrigins,
+			AllowedOperations: rule.AllowedOperations,
+			AllowedHeaders:    rule.AllowedHeaders,
+			ExposeHeaders:     rule.ExposeHeaders,
+			MaxAgeSeconds:     rule.MaxAgeSeconds,
+		})
+	}
+	return rules
+}
+
+// FileLock holds a bucket's object lock settings.  If Readable is false, the
+// key is not authorized to read them, and the other fields are unset.
+type FileLock struct {
+	Readable        bool
+	Enabled         bool
+	RetentionMode   string
+	RetentionPeriod int
+	RetentionUnit   string
+}
+
+func fileLockFromB2(b2fl *b2types.FileLockConfiguration) *FileLock {
+	if b2fl == nil {
+		return nil
+	}
+	fl := &FileLock{Readable: b2fl.Readable}
+	if v := b2fl.Value; v != nil {
+		fl.Enabled = v.Enabled
+		fl.RetentionMode = v.DefaultRetention.Mode
+		if p := v.DefaultRetention.Period; p != nil {
+			fl.RetentionPeriod = p.Duration
+			fl.RetentionUnit = p.Unit
+		}
+	}
+	return fl
+}
+
+// ReplicationRule describes a single replication rule for a source bucket.
+type ReplicationRule struct {
+	Name                string
+	DestinationBucketID string
+	Prefix              string
+	Priority            int
+	Enabled             bool
+	IncludeExisting     bool
+}
+
+// ReplicationConfiguration holds a bucket's cloud replication settings.  A
+// bucket may be a replication source, a replication destination, or both.
+type ReplicationConfiguration struct {
+	SourceKeyID   string
+	SourceRules   []ReplicationRule
+	IsSource      bool
+	KeyMapping    map[string]string
+	IsDestination bool
+}
+
+func (rc *ReplicationConfiguration) toB2() *b2types.ReplicationConfiguration {
+	if rc == nil {
+		return nil
+	}
+	b2rc := &b2types.ReplicationConfiguration{}
+	if rc.IsSource {
+		src := &b2types.ReplicationSource{KeyID: rc.SourceKeyID}
+		for _, rule := range rc.SourceRules {
+			src.Rules = append(src.Rules, b2types.ReplicationRule{
+				Name:                rule.Name,
+				DestinationBucketID: rule.DestinationBucketID,
+				Prefix:              rule.Prefix,
+				Priority:            rule.Priority,
+				Enabled:             rule.Enabled,
+				IncludeExisting:     rule.IncludeExisting,
+			})
+		}
+		b2rc.AsSource = src
+	}
+	if rc.IsDestination {
+		b2rc.AsDestination = &b2types.ReplicationDestination{KeyMapping: rc.KeyMapping}
+	}
+	return b2rc
+}
+
+func replicationFromB2(resp *b2types.ReplicationResponse) *ReplicationConfiguration {
+	if resp == nil || resp.Value == nil {
+		return nil
+	}
+	b2rc := resp.Value
+	rc := &ReplicationConfiguration{}
+	if src := b2rc.AsSource; src != nil {
+		rc.IsSource = true
+		rc.SourceKeyID = src.KeyID
+		for _, rule := range src.Rules {
+			rc.SourceRules = append(rc.SourceRules, ReplicationRule{
+				Name:                rule.Name,
+				DestinationBucketID: rule.DestinationBucketID,
+				Prefix:              rule.Prefix,
+				Priority:            rule.Priority,
+				Enabled:             rule.Enabled,
+				IncludeExisting:     rule.IncludeExisting,
+			})
+		}
+	}
+	if dst := b2rc.AsDestination; dst != nil {
+		rc.IsDestination = true
+		rc.KeyMapping = dst.KeyMapping
+	}
+	return rc
+}
+
 // CreateBucket wraps b2_create_bucket.
 func (b *B2) CreateBucket(ctx context.Context, name, btype string, info map[string]string, rules []LifecycleRule) (*Bucket, error) {
 	if btype != "allPublic" {
@@ -544,7 +740,7 @@ func (b *B2) CreateBucket(ctx context.Context, name, btype string, info map[stri
 	headers := map[string]string{
 		"Authorization": b.authToken,
 	}
-	if err := b.opts.makeRequest(ctx, "b2_create_bucket", "POST", b.apiURI+b2types.V1api+"b2_create_bucket", b2req, b2resp, headers, nil); err != nil {
+	if err := b.opts.makeRequest(ctx, "b2_create_bucket", "POST", b.apiURI+b2types.V2api+"b2_create_bucket", b2req, b2resp, headers, nil); err != nil {
 		return nil, err
 	}
 	var respRules []LifecycleRule
@@ -559,6 +755,9 @@ func (b *B2) CreateBucket(ctx context.Context, name, btype string, info map[stri
 		Name:           name,
 		Info:           b2resp.Info,
 		LifecycleRules: respRules,
+		CORSRules:      corsFromB2(b2resp.CORSRules),
+		FileLock:       fileLockFromB2(b2resp.FileLock),
+		Replication:    replicationFromB2(b2resp.Replication),
 		ID:             b2resp.BucketID,
 		rev:            b2resp.Revision,
 		b2:             b,
@@ -583,6 +782,9 @@ type Bucket struct {
 	Type           string
 	Info           map[string]string
 	LifecycleRules []LifecycleRule
+	CORSRules      []CORSRule
+	FileLock       *FileLock
+	Replication    *ReplicationConfiguration
 	ID             string
 	rev            int
 	b2             *B2
@@ -605,13 +807,14 @@ func (b *Bucket) Update(ctx context.Context) (*Bucket, error) {
 		Type:           b.Type,
 		Info:           b.Info,
 		LifecycleRules: rules,
+		Replication:    b.Replication.toB2(),
 		IfRevisionIs:   b.rev,
 	}
 	headers := map[string]string{
 		"Authorization": b.b2.authToken,
 	}
 	b2resp := &b2types.UpdateBucketResponse{}
-	if err := b.b2.opts.makeRequest(ctx, "b2_update_bucket", "POST", b.b2.apiURI+b2types.V1api+"b2_update_bucket", b2req, b2resp, headers, nil); err != nil {
+	if err := b.b2.opts.makeRequest(ctx, "b2_update_bucket", "POST", b.b2.apiURI+b2types.V2api+"b2_update_bucket", b2req, b2resp, headers, nil); err != nil {
 		return nil, err
 	}
 	var respRules []LifecycleRule
@@ -627,6 +830,9 @@ func (b *Bucket) Update(ctx context.Context) (*Bucket, error) {
 		Type:           b2resp.Type,
 		Info:           b2resp.Info,
 		LifecycleRules: respRules,
+		CORSRules:      corsFromB2(b2resp.CORSRules),
+		FileLock:       fileLockFromB2(b2resp.FileLock),
+		Replication:    replicationFromB2(b2resp.Replication),
 		ID:             b2resp.BucketID,
 		b2:             b.b2,
 	}, nil
@@ -649,7 +855,7 @@ func (b *B2) ListBuckets(ctx context.Context, name string) ([]*Bucket, error) {
 	headers := map[string]string{
 		"Authorization": b.authToken,
 	}
-	if err := b.opts.makeRequest(ctx, "b2_list_buckets", "POST", b.apiURI+b2types.V1api+"b2_list_buckets", b2req, b2resp, headers, nil); err != nil {
+	if err := b.opts.makeRequest(ctx, "b2_list_buckets", "POST", b.apiURI+b2types.V2api+"b2_list_buckets", b2req, b2resp, headers, nil); err != nil {
 		return nil, err
 	}
 	var buckets []*Bucket
@@ -667,6 +873,9 @@ func (b *B2) ListBuckets(ctx context.Context, name string) ([]*Bucket, error) {
 			Type:           bucket.Type,
 			Info:           bucket.Info,
 			LifecycleRules: rules,
+			CORSRules:      corsFromB2(bucket.CORSRules),
+			FileLock:       fileLockFromB2(bucket.FileLock),
+			Replication:    replicationFromB2(bucket.Replication),
 			ID:             bucket.BucketID,
 			rev:            bucket.Revision,
 			b2:             b,
@@ -732,6 +941,12 @@ func (b *Bucket) File(id, name string) *File {
 	return &File{ID: id, b2: b.b2, Name: name}
 }
 
+// File returns a bare File with the given ID, for calls such as GetFileInfo
+// that need nothing else.
+func (b *B2) File(id string) *File {
+	return &File{ID: id, b2: b}
+}
+
 // UploadFile wraps b2_upload_file.
 func (url *URL) UploadFile(ctx context.Context, r io.Reader, size int, name, contentType, sha1 string, info map[string]string) (*File, error) {
 	headers := map[string]string{
@@ -931,6 +1146,30 @@ func (fc *FileChunk) UploadPart(ctx context.Context, r io.Reader, sha1 string, s
 	return size, nil
 }
 
+// CopyPart wraps b2_copy_part.  It copies the given HTTP byte range (or all)
+// of the source file into part index of the large file, and returns the
+// part's size and SHA1.
+func (l *LargeFile) CopyPart(ctx context.Context, srcID, rng string, index int) (int64, string, error) {
+	b2req := &b2types.CopyPartRequest{
+		SourceID:    srcID,
+		LargeFileID: l.ID,
+		PartNumber:  index,
+		Range:       rng,
+	}
+	b2resp := &b2types.CopyPartResponse{}
+	headers := map[string]string{
+		"Authorization": l.b2.authToken,
+	}
+	if err := l.b2.opts.makeRequest(ctx, "b2_copy_part", "POST", l.b2.apiURI+b2types.V1api+"b2_copy_part", b2req, b2resp, headers, nil); err != nil {
+		return 0, "", err
+	}
+	l.mu.Lock()
+	l.hashes[index] = b2resp.SHA1
+	l.size += b2resp.Size
+	l.mu.Unlock()
+	return b2resp.Size, b2resp.SHA1, nil
+}
+
 // FinishLargeFile wraps b2_finish_large_file.
 func (l *LargeFile) FinishLargeFile(ctx context.Context) (*File, error) {
 	l.mu.Lock()
@@ -982,12 +1221,14 @@ func (b *Bucket) ListUnfinishedLargeFiles(ctx context.Context, count int, contin
 		files = append(files, &File{
 			Name:      f.Name,
 			Timestamp: millitime(f.Timestamp),
+			Status:    "start",
 			b2:        b.b2,
 			ID:        f.FileID,
 			Info: &FileInfo{
 				Name:        f.Name,
 				ContentType: f.ContentType,
 				Info:        f.Info,
+				Status:      "start",
 				Timestamp:   millitime(f.Timestamp),
 			},
 		})
@@ -1104,11 +1345,12 @@ func (b *Bucket) GetDownloadAuthorization(ctx context.Context, prefix string, va
 // FileReader is an io.ReadCloser that downloads a file from B2.
 type FileReader struct {
 	io.ReadCloser
-	ContentLength int
-	ContentType   string
-	SHA1          string
-	ID            string
-	Info          map[string]string
+	ContentLength   int
+	ContentType     string
+	SHA1            string
+	ID              string
+	Info            map[string]string
+	UploadTimestamp time.Time
 }
 
 func mkRange(offset, size int64) string {
@@ -1124,6 +1366,16 @@ func mkRange(offset, size int64) string {
 // DownloadFileByName wraps b2_download_file_by_name.
 func (b *Bucket) DownloadFileByName(ctx context.Context, name string, offset, size int64, header bool) (*FileReader, error) {
 	uri := fmt.Sprintf("%s/file/%s/%s", b.b2.downloadURI, b.Name, escape(name))
+	return b.b2.downloadFile(ctx, "b2_download_file_by_name", uri, offset, size, header)
+}
+
+// DownloadFileByID wraps b2_download_file_by_id.
+func (b *B2) DownloadFileByID(ctx context.Context, id string, offset, size int64, header bool) (*FileReader, error) {
+	uri := fmt.Sprintf("%s%sb2_download_file_by_id?fileId=%s", b.downloadURI, b2types.V1api, url.QueryEscape(id))
+	return b.downloadFile(ctx, "b2_download_file_by_id", uri, offset, size, header)
+}
+
+func (b *B2) downloadFile(ctx context.Context, api, uri string, offset, size int64, header bool) (*FileReader, error) {
 	method := "GET"
 	if header {
 		method = "HEAD"
@@ -1132,16 +1384,18 @@ func (b *Bucket) DownloadFileByName(ctx context.Context, name string, offset, si
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", b.b2.authToken)
+	if b.authToken != "" {
+		req.Header.Set("Authorization", b.authToken)
+	}
 	req.Header.Set("X-Blazer-Request-ID", fmt.Sprintf("%d", atomic.AddInt64(&reqID, 1)))
-	req.Header.Set("X-Blazer-Method", "b2_download_file_by_name")
-	b.b2.opts.addHeaders(req)
+	req.Header.Set("X-Blazer-Method", api)
+	b.opts.addHeaders(req)
 	rng := mkRange(offset, size)
 	if rng != "" {
 		req.Header.Set("Range", rng)
 	}
 	logRequest(req, nil)
-	resp, err := makeNetRequest(ctx, req, b.b2.opts.getTransport())
+	resp, err := makeNetRequest(ctx, req, b.opts.getTransport())
 	if err != nil {
 		return nil, err
 	}
@@ -1176,13 +1430,18 @@ func (b *Bucket) DownloadFileByName(ctx context.Context, name string, offset, si
 	if sha1 == "none" && info["Large_file_sha1"] != "" {
 		sha1 = info["Large_file_sha1"]
 	}
+	var stamp time.Time
+	if ms, err := strconv.ParseInt(resp.Header.Get("X-Bz-Upload-Timestamp"), 10, 64); err == nil {
+		stamp = millitime(ms)
+	}
 	return &FileReader{
-		ReadCloser:    resp.Body,
-		SHA1:          sha1,
-		ID:            resp.Header.Get("X-Bz-File-Id"),
-		ContentType:   resp.Header.Get("Content-Type"),
-		ContentLength: int(clen),
-		Info:          info,
+		ReadCloser:      resp.Body,
+		SHA1:            sha1,
+		ID:              resp.Header.Get("X-Bz-File-Id"),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentLength:   int(clen),
+		Info:            info,
+		UploadTimestamp: stamp,
 	}, nil
 }
 
@@ -1211,6 +1470,7 @@ func (b *Bucket) HideFile(ctx context.Context, name string) (*File, error) {
 // FileInfo holds information about a specific file.
 type FileInfo struct {
 	Name        string
+	BucketID    string
 	SHA1        string
 	MD5         string
 	Size        int64
@@ -1237,6 +1497,7 @@ func (f *File) GetFileInfo(ctx context.Context) (*FileInfo, error) {
 	f.Timestamp = millitime(b2resp.Timestamp)
 	f.Info = &FileInfo{
 		Name:        b2resp.Name,
+		BucketID:    b2resp.BucketID,
 		SHA1:        b2resp.SHA1,
 		MD5:         b2resp.MD5,
 		Size:        b2resp.Size,
@@ -1248,6 +1509,81 @@ func (f *File) GetFileInfo(ctx context.Context) (*FileInfo, error) {
 	return f.Info, nil
 }
 
+// ServerSideEncryption describes how B2 encrypts a file at rest.  Mode is
+// "SSE-B2", for keys managed by B2, or "SSE-C", for a key supplied by the
+// caller in Key.
+type ServerSideEncryption struct {
+	Mode      string
+	Algorithm string
+	Key       []byte
+}
+
+func (s *ServerSideEncryption) toB2() *b2types.ServerSideEncryption {
+	if s == nil {
+		return nil
+	}
+	sse := &b2types.ServerSideEncryption{
+		Mode:      s.Mode,
+		Algorithm: s.Algorithm,
+	}
+	if sse.Algorithm == "" {
+		sse.Algorithm = "AES256"
+	}
+	if len(s.Key) > 0 {
+		sum := md5.Sum(s.Key)
+		sse.CustomerKey = base64.StdEncoding.EncodeToString(s.Key)
+		sse.CustomerKeyMD5 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return sse
+}
+
+// CopyFile wraps b2_copy_file.  If dstBucketID is empty, the file is copied
+// within its own bucket.  The directive must be "COPY", to keep the source
+// file's metadata, or "REPLACE", to use contentType and info instead.  If rng
+// is non-empty, it is an HTTP byte range, and only that part of the file is
+// copied.  dstSSE sets the encryption of the new file, and srcSSE supplies the
+// key of a source file encrypted with SSE-C; either may be nil.
+func (f *File) CopyFile(ctx context.Context, name, rng, dstBucketID, directive, contentType string, info map[string]string, dstSSE, srcSSE *ServerSideEncryption) (*File, error) {
+	b2req := &b2types.CopyFileRequest{
+		SourceID:            f.ID,
+		DestinationBucketID: dstBucketID,
+		Name:                name,
+		Range:               rng,
+		MetadataDirective:   directive,
+		DestinationSSE:      dstSSE.toB2(),
+		SourceSSE:           srcSSE.toB2(),
+	}
+	if directive == "REPLACE" {
+		b2req.ContentType = contentType
+		b2req.Info = info
+	}
+	b2resp := &b2types.CopyFileResponse{}
+	headers := map[string]string{
+		"Authorization": f.b2.authToken,
+	}
+	if err := f.b2.opts.makeRequest(ctx, "b2_copy_file", "POST", f.b2.apiURI+b2types.V1api+"b2_copy_file", b2req, b2resp, headers, nil); err != nil {
+		return nil, err
+	}
+	return &File{
+		Name:      b2resp.Name,
+		Size:      b2resp.Size,
+		Status:    b2resp.Action,
+		Timestamp: millitime(b2resp.Timestamp),
+		Info: &FileInfo{
+			Name:        b2resp.Name,
+			SHA1:        b2resp.SHA1,
+			MD5:         b2resp.MD5,
+			Size:        b2resp.Size,
+			ContentType: b2resp.ContentType,
+			Info:        b2resp.Info,
+			Status:      b2resp.Action,
+			Timestamp:   millitime(b2resp.Timestamp),
+		},
+		ID: b2resp.FileID,
+		b2: f.b2,
+	}, nil
+}
+
 // Key is a B2 application key.
 type Key struct {
 	ID           string
@@ -1287,13 +1623,18 @@ func (b *B2) CreateKey(ctx context.Context, name string, caps []string, valid ti
 
 // Delete wraps b2_delete_key.
 func (k *Key) Delete(ctx context.Context) error {
+	return k.b2.DeleteKey(ctx, k.ID)
+}
+
+// DeleteKey wraps b2_delete_key, for the key with the given ID.
+func (b *B2) DeleteKey(ctx context.Context, id string) error {
 	b2req := &b2types.DeleteKeyRequest{
-		KeyID: k.ID,
+		KeyID: id,
 	}
 	headers := map[string]string{
-		"Authorization": k.b2.authToken,
+		"Authorization": b.authToken,
 	}
-	return k.b2.opts.makeRequest(ctx, "b2_delete_key", "POST", k.b2.apiURI+b2types.V1api+"b2_delete_key", b2req, nil, headers, nil)
+	return b.opts.makeRequest(ctx, "b2_delete_key", "POST", b.apiURI+b2types.V1api+"b2_delete_key", b2req, nil, headers, nil)
 }
 
 // ListKeys wraps b2_list_keys.
@@ -20,6 +20,7 @@ package b2types
 
 const (
 	V1api = "/b2api/v1/"
+	V2api = "/b2api/v2/"
 )
 
 type ErrorMessage struct {
@@ -33,6 +34,7 @@ type AuthorizeAccountResponse struct {
 	AuthToken      string    `json:"authorizationToken"`
 	URI            string    `json:"apiUrl"`
 	DownloadURI    string    `json:"downloadUrl"`
+	S3URI          string    `json:"s3ApiUrl"`
 	MinPartSize    int       `json:"minimumPartSize"`
 	PartSize       int       `json:"recommendedPartSize"`
 	AbsMinPartSize int       `json:"absoluteMinimumPartSize"`
@@ -42,6 +44,7 @@ type AuthorizeAccountResponse struct {
 type Allowance struct {
 	Capabilities []string `json:"capabilities"`
 	Bucket       string   `json:"bucketId"`
+	BucketName   string   `json:"bucketName"`
 	Prefix       string   `json:"namePrefix"`
 }
 
@@ -59,13 +62,75 @@ type CreateBucketRequest struct {
 	LifecycleRules []LifecycleRule   `json:"lifecycleRules"`
 }
 
+type ReplicationRule struct {
+	DestinationBucketID string `json:"destinationBucketId"`
+	Prefix              string `json:"fileNamePrefix"`
+	IncludeExisting     bool   `json:"includeExistingFiles"`
+	Enabled             bool   `json:"isEnabled"`
+	Priority            int    `json:"priority"`
+	Name                string `json:"replicationRuleName"`
+}
+
+type ReplicationSource struct {
+	Rules []ReplicationRule `json:"replicationRules"`
+	KeyID string            `json:"sourceApplicationKeyId"`
+}
+
+type ReplicationDestination struct {
+	KeyMapping map[string]string `json:"sourceToDestinationKeyMapping"`
+}
+
+// ReplicationConfiguration is sent as is, with a null for each side the
+// bucket does not play, so that sending neither removes replication.
+type ReplicationConfiguration struct {
+	AsSource      *ReplicationSource      `json:"asReplicationSource"`
+	AsDestination *ReplicationDestination `json:"asReplicationDestination"`
+}
+
+type ReplicationResponse struct {
+	Readable bool                      `json:"isClientAuthorizedToRead"`
+	Value    *ReplicationConfiguration `json:"value"`
+}
+
+type CORSRule struct {
+	Name              string   `json:"corsRuleName"`
+	AllowedOrigins    []string `json:"allowedOrigins"`
+	AllowedOperations []string `json:"allowedOperations"`
+	AllowedHeaders    []string `json:"allowedHeaders,omitempty"`
+	ExposeHeaders     []string `json:"exposeHeaders,omitempty"`
+	MaxAgeSeconds     int      `json:"maxAgeSeconds"`
+}
+
+type RetentionPeriod struct {
+	Duration int    `json:"duration"`
+	Unit     string `json:"unit"`
+}
+
+type DefaultRetention struct {
+	Mode   string           `json:"mode"`
+	Period *RetentionPeriod `json:"period"`
+}
+
+type FileLockSettings struct {
+	Enabled          bool             `json:"isFileLockEnabled"`
+	DefaultRetention DefaultRetention `json:"defaultRetention"`
+}
+
+type FileLockConfiguration struct {
+	Readable bool              `json:"isClientAuthorizedToRead"`
+	Value    *FileLockSettings `json:"value"`
+}
+
 type CreateBucketResponse struct {
-	BucketID       string            `json:"bucketId"`
-	Name           string            `json:"bucketName"`
-	Type           string            `json:"bucketType"`
-	Info           map[string]string `json:"bucketInfo"`
-	LifecycleRules []LifecycleRule   `json:"lifecycleRules"`
-	Revision       int               `json:"revision"`
+	BucketID       string                 `json:"bucketId"`
+	Name           string                 `json:"bucketName"`
+	Type           string                 `json:"bucketType"`
+	Info           map[string]string      `json:"bucketInfo"`
+	LifecycleRules []LifecycleRule        `json:"lifecycleRules"`
+	CORSRules      []CORSRule             `json:"corsRules"`
+	FileLock       *FileLockConfiguration `json:"fileLockConfiguration,omitempty"`
+	Replication    *ReplicationResponse   `json:"replicationConfiguration,omitempty"`
+	Revision       int                    `json:"revision"`
 }
 
 type DeleteBucketRequest struct {
@@ -84,12 +149,13 @@ type ListBucketsResponse struct {
 }
 
 type UpdateBucketRequest struct {
-	AccountID      string            `json:"accountId"`
-	BucketID       string            `json:"bucketId"`
-	Type           string            `json:"bucketType,omitempty"`
-	Info           map[string]string `json:"bucketInfo,omitempty"`
-	LifecycleRules []LifecycleRule   `json:"lifecycleRules,omitempty"`
-	IfRevisionIs   int               `json:"ifRevisionIs,omitempty"`
+	AccountID      string                    `json:"accountId"`
+	BucketID       string                    `json:"bucketId"`
+	Type           string                    `json:"bucketType,omitempty"`
+	Info           map[string]string         `json:"bucketInfo,omitempty"`
+	LifecycleRules []LifecycleRule           `json:"lifecycleRules,omitempty"`
+	Replication    *ReplicationConfiguration `json:"replicationConfiguration,omitempty"`
+	IfRevisionIs   int                       `json:"ifRevisionIs,omitempty"`
 }
 
 type UpdateBucketResponse CreateBucketResponse
@@ -219,6 +285,41 @@ type GetFileInfoResponse struct {
 	Timestamp   int64             `json:"uploadTimestamp,omitempty"`
 }
 
+type ServerSideEncryption struct {
+	Mode           string `json:"mode"`
+	Algorithm      string `json:"algorithm"`
+	CustomerKey    string `json:"customerKey,omitempty"`
+	CustomerKeyMD5 string `json:"customerKeyMd5,omitempty"`
+}
+
+type CopyFileRequest struct {
+	SourceID            string                `json:"sourceFileId"`
+	DestinationBucketID string                `json:"destinationBucketId,omitempty"`
+	Name                string                `json:"fileName"`
+	Range               string                `json:"range,omitempty"`
+	MetadataDirective   string                `json:"metadataDirective,omitempty"`
+	ContentType         string                `json:"contentType,omitempty"`
+	Info                map[string]string     `json:"fileInfo,omitempty"`
+	DestinationSSE      *ServerSideEncryption `json:"destinationServerSideEncryption,omitempty"`
+	SourceSSE           *ServerSideEncryption `json:"sourceServerSideEncryption,omitempty"`
+}
+
+type CopyFileResponse GetFileInfoResponse
+
+type CopyPartRequest struct {
+	SourceID    string `json:"sourceFileId"`
+	LargeFileID string `json:"largeFileId"`
+	PartNumber  int    `json:"partNumber"`
+	Range       string `json:"range,omitempty"`
+}
+
+type CopyPartResponse struct {
+	FileID     string `json:"fileId"`
+	PartNumber int    `json:"partNumber"`
+	Size       int64  `json:"contentLength"`
+	SHA1       string `json:"contentSha1"`
+}
+
 type GetDownloadAuthorizationRequest struct {
 	BucketID           string `json:"bucketId"`
 	Prefix             string `json:"fileNamePrefix"`
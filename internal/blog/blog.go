@@ -52,3 +52,9 @@ func (v Verbose) Infof(format string, a ...interface{}) {
 func V(target int32) Verbose {
 	return Verbose(target <= level)
 }
+
+// VOverride is like V, but also logs at target if it is no more than
+// override, whatever the global level.
+func VOverride(target, override int32) Verbose {
+	return Verbose(target <= level || target <= override)
+}